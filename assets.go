@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// maxAssetsPerPage bounds the icons, scripts and stylesheets fetched per page
+	maxAssetsPerPage = 20
+	// maxAssetSize bounds the bytes read from each asset
+	maxAssetSize = 5 * 1024 * 1024
+)
+
+// Asset kinds
+const (
+	AssetFavicon    = "favicon"
+	AssetIcon       = "icon"
+	AssetScript     = "script"
+	AssetStylesheet = "stylesheet"
+)
+
+// PageAsset is a static file referenced by a page, hashed for pivoting
+type PageAsset struct {
+	URL         string `json:"url"`
+	Kind        string `json:"kind"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256"`
+	// MMH3 is the Shodan-style favicon hash: MurmurHash3 of the base64 body
+	MMH3 int32 `json:"mmh3"`
+}
+
+// SharedAsset is an asset served by more than one target
+type SharedAsset struct {
+	SHA256  string   `json:"sha256"`
+	MMH3    int32    `json:"mmh3"`
+	Kind    string   `json:"kind"`
+	URLs    []string `json:"urls"`
+	Targets []string `json:"targets"`
+}
+
+// assetRef is an asset URL found on a page
+type assetRef struct {
+	url  string
+	kind string
+}
+
+// pageAssetRefs returns /favicon.ico plus the icons, scripts and stylesheets
+// linked from an HTML page, resolved against the page URL
+func pageAssetRefs(pageURL, content string) []assetRef {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	refs := []assetRef{{url: base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String(), kind: AssetFavicon}}
+
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return refs
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			var ref, kind string
+			switch n.Data {
+			case "base":
+				if href := htmlAttr(n, "href"); href != "" {
+					if resolved, err := base.Parse(href); err == nil {
+						base = resolved
+					}
+				}
+			case "link":
+				rel := strings.Fields(strings.ToLower(htmlAttr(n, "rel")))
+				for _, r := range rel {
+					switch r {
+					case "icon", "apple-touch-icon", "mask-icon":
+						ref, kind = htmlAttr(n, "href"), AssetIcon
+					case "stylesheet":
+						ref, kind = htmlAttr(n, "href"), AssetStylesheet
+					}
+				}
+			case "script":
+				ref, kind = htmlAttr(n, "src"), AssetScript
+			}
+			if ref = strings.TrimSpace(ref); ref != "" {
+				if resolved, err := base.Parse(ref); err == nil && (resolved.Scheme == "http" || resolved.Scheme == "https") {
+					resolved.Fragment = ""
+					refs = append(refs, assetRef{url: resolved.String(), kind: kind})
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	seen := make(map[string]bool)
+	unique := refs[:0]
+	for _, ref := range refs {
+		if !seen[ref.url] && len(unique) < maxAssetsPerPage {
+			seen[ref.url] = true
+			unique = append(unique, ref)
+		}
+	}
+	return unique
+}
+
+// fetchAsset downloads and hashes a single asset; missing assets are not an
+// error but return nil
+func fetchAsset(client *http.Client, ref assetRef) (*PageAsset, error) {
+	resp, body, err := fetchURL(client, ref.url, maxAssetSize)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		return nil, nil
+	}
+
+	sum := sha256.Sum256(body)
+	return &PageAsset{
+		URL:         ref.url,
+		Kind:        ref.kind,
+		ContentType: resp.Header.Get("Content-Type"),
+		Size:        len(body),
+		SHA256:      hex.EncodeToString(sum[:]),
+		MMH3:        faviconHash(body),
+	}, nil
+}
+
+// fetchAssets fetches and hashes the assets of every seed page in the
+// report. Assets shared by several pages are only downloaded once.
+func fetchAssets(client *http.Client, report *ScanReport) {
+	cache := make(map[string]*PageAsset)
+	fetched := 0
+	for i := range report.Results {
+		result := &report.Results[i]
+		if !hasContent(*result) || !isHTMLContent(result.ContentType) || result.Depth > 0 {
+			continue
+		}
+		for _, ref := range pageAssetRefs(servedURL(*result), result.Content) {
+			asset, ok := cache[ref.url]
+			if !ok {
+				var err error
+				asset, err = fetchAsset(client, ref)
+				if err != nil {
+					fmt.Printf("[WARN] Asset %s -> %v\n", ref.url, err)
+				}
+				cache[ref.url] = asset
+				fetched++
+			}
+			if asset != nil {
+				result.Assets = append(result.Assets, *asset)
+			}
+		}
+	}
+	fmt.Printf("[INFO] Fetched %d assets\n", fetched)
+}
+
+// groupSharedAssets returns the assets whose content is served by more than
+// one target, favicons first
+func groupSharedAssets(results []ScanResult) []SharedAsset {
+	groups := make(map[string]*SharedAsset)
+	var order []string
+	for _, result := range results {
+		target := result.SeedURL
+		if target == "" {
+			target = resultKey(result)
+		}
+		for _, asset := range result.Assets {
+			group, ok := groups[asset.SHA256]
+			if !ok {
+				group = &SharedAsset{SHA256: asset.SHA256, MMH3: asset.MMH3, Kind: asset.Kind}
+				groups[asset.SHA256] = group
+				order = append(order, asset.SHA256)
+			}
+			if !containsString(group.URLs, asset.URL) {
+				group.URLs = append(group.URLs, asset.URL)
+			}
+			if !containsString(group.Targets, target) {
+				group.Targets = append(group.Targets, target)
+			}
+		}
+	}
+
+	var shared []SharedAsset
+	for _, hash := range order {
+		if len(groups[hash].Targets) > 1 {
+			shared = append(shared, *groups[hash])
+		}
+	}
+	sort.SliceStable(shared, func(i, j int) bool {
+		return shared[i].Kind == AssetFavicon && shared[j].Kind != AssetFavicon
+	})
+	return shared
+}
+
+// faviconHash returns the MurmurHash3 of the base64-encoded data with a line
+// break every 76 characters, matching Shodan's http.favicon.hash
+func faviconHash(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var sb strings.Builder
+	for len(encoded) > 76 {
+		sb.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	sb.WriteString(encoded + "\n")
+	return int32(murmur3(0, []byte(sb.String())))
+}
+
+// murmur3 is the 32-bit x86 MurmurHash3
+func murmur3(seed uint32, data []byte) uint32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	h := seed
+	n := len(data) / 4 * 4
+	for i := 0; i < n; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	switch len(data) & 3 {
+	case 3:
+		k ^= uint32(data[n+2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(data[n+1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(data[n])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
+
+// generateSharedAssetsSection renders the assets shared between targets for
+// the HTML report
+func generateSharedAssetsSection(shared []SharedAsset) string {
+	if len(shared) == 0 {
+		return ""
+	}
+
+	section := `
+
+            <h2>🔗 Shared Assets</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>Kind</th>
+                        <th>Hash</th>
+                        <th>Targets</th>
+                    </tr>
+                </thead>
+                <tbody>`
+
+	for _, asset := range shared {
+		var targets []string
+		for _, target := range asset.Targets {
+			targets = append(targets, escapeHTML(target))
+		}
+		section += fmt.Sprintf(`
+                    <tr>
+                        <td>%s</td>
+                        <td>mmh3: %d<br><small>sha256: %s</small></td>
+                        <td>%s</td>
+                    </tr>`,
+			asset.Kind, asset.MMH3, asset.SHA256, strings.Join(targets, "<br>"))
+	}
+
+	section += `
+                </tbody>
+            </table>`
+	return section
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	// Reference vectors for 32-bit x86 MurmurHash3
+	tests := []struct {
+		data string
+		seed uint32
+		want uint32
+	}{
+		{"", 0, 0},
+		{"", 1, 0x514e28b7},
+		{"", 0xffffffff, 0x81f16f39},
+		{"\xff\xff\xff\xff", 0, 0x76293b50},
+		{"!Ce\x87", 0, 0xf55b516b},
+		{"!Ce\x87", 0x5082edee, 0x2362f9de},
+		{"!Ce", 0, 0x7e4a8634},
+		{"!C", 0, 0xa0f7b07a},
+		{"!", 0, 0x72661cf4},
+		{"\x00\x00\x00\x00", 0, 0x2362f9de},
+		{"test", 0, 0xba6bd213},
+		{"The quick brown fox jumps over the lazy dog", 0x9747b28c, 0x2fa826cd},
+	}
+	for _, tt := range tests {
+		if got := murmur3(tt.seed, []byte(tt.data)); got != tt.want {
+			t.Errorf("murmur3(%#x, %q) = %#x, want %#x", tt.seed, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestFaviconHash(t *testing.T) {
+	// mmh3.hash(codecs.encode(data, "base64")) as Shodan computes it; 256
+	// bytes span several 76-character base64 lines
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	if got := faviconHash(data); got != -757223386 {
+		t.Errorf("faviconHash = %d, want -757223386", got)
+	}
+}
+
+func TestPageAssetRefs(t *testing.T) {
+	content := `<html><head>
+<link rel="icon" href="/static/icon.png">
+<link rel="stylesheet" href="css/site.css#top">
+<link rel="preload" href="/font.woff2">
+<script src="https://cdn.example.onion/app.js"></script>
+<script src="javascript:void(0)"></script>
+<script>inline()</script>
+<base href="http://abc.onion/sub/">
+<script src="late.js"></script>
+<script src="/static/icon.png"></script>
+</head></html>`
+	got := pageAssetRefs("http://abc.onion/forum/index.html", content)
+	want := []assetRef{
+		{"http://abc.onion/favicon.ico", AssetFavicon},
+		{"http://abc.onion/static/icon.png", AssetIcon},
+		{"http://abc.onion/forum/css/site.css", AssetStylesheet},
+		{"https://cdn.example.onion/app.js", AssetScript},
+		{"http://abc.onion/sub/late.js", AssetScript},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pageAssetRefs =\n%v\nwant\n%v", got, want)
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultChallenges are the built-in anti-DDoS and CAPTCHA signatures used
+// when the targets file does not name a signatures file
+//
+//go:embed challenges.yaml
+var defaultChallenges []byte
+
+// Challenge types
+const (
+	ChallengeQueue        = "queue"
+	ChallengeCaptcha      = "captcha"
+	ChallengeInterstitial = "interstitial"
+	ChallengeJS           = "js_challenge"
+)
+
+// Default waits between challenge retries
+const (
+	defaultChallengeWait    = 5 * time.Second
+	defaultChallengeMaxWait = 60 * time.Second
+)
+
+// ChallengeSignature describes how to recognize one queue, interstitial or
+// CAPTCHA page. Patterns are case-insensitive regexes; any title, HTML or
+// header match is enough, as long as every Require pattern and no Exclude
+// pattern matches the HTML too.
+type ChallengeSignature struct {
+	Name    string                 `yaml:"name"`
+	Type    string                 `yaml:"type"`
+	Title   patternList            `yaml:"title,omitempty"`
+	HTML    patternList            `yaml:"html,omitempty"`
+	Headers map[string]patternList `yaml:"headers,omitempty"`
+	Require patternList            `yaml:"require,omitempty"`
+	Exclude patternList            `yaml:"exclude,omitempty"`
+}
+
+// compiledChallenge is a signature with its patterns compiled
+type compiledChallenge struct {
+	name    string
+	kind    string
+	title   []*regexp.Regexp
+	html    []*regexp.Regexp
+	headers map[string][]*regexp.Regexp
+	require []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// ChallengeRules is a loaded signatures file
+type ChallengeRules struct {
+	signatures []*compiledChallenge
+}
+
+// ChallengeInfo is the challenge a page was gated by
+type ChallengeInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Attempts is the number of times the page was fetched
+	Attempts int `json:"attempts"`
+	// Passed is set when a retry got past the challenge
+	Passed bool `json:"passed,omitempty"`
+}
+
+// challengeSettings controls the challenge detection pipeline step
+type challengeSettings struct {
+	Rules *ChallengeRules
+	// Retries is the number of times queue and interstitial pages are refetched
+	Retries int
+	// MaxWait caps the wait before each retry
+	MaxWait time.Duration
+}
+
+// loadChallengeRules reads a signatures file, or the built-in signatures
+// when path is empty
+func loadChallengeRules(path string) (*ChallengeRules, error) {
+	data := defaultChallenges
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read challenge signatures: %w", err)
+		}
+	}
+
+	var file struct {
+		Signatures []ChallengeSignature `yaml:"signatures"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse challenge signatures %s: %w", path, err)
+	}
+
+	rules := &ChallengeRules{}
+	for _, signature := range file.Signatures {
+		compiled, err := compileChallenge(signature)
+		if err != nil {
+			return nil, err
+		}
+		rules.signatures = append(rules.signatures, compiled)
+	}
+	return rules, nil
+}
+
+// compileChallenge validates a signature and compiles its patterns
+func compileChallenge(signature ChallengeSignature) (*compiledChallenge, error) {
+	switch signature.Type {
+	case ChallengeQueue, ChallengeCaptcha, ChallengeInterstitial, ChallengeJS:
+	default:
+		return nil, fmt.Errorf("challenge signature %q: unknown type %q", signature.Name, signature.Type)
+	}
+	if signature.Name == "" {
+		return nil, fmt.Errorf("challenge signature without a name")
+	}
+
+	var compileErr error
+	compileList := func(list patternList) []*regexp.Regexp {
+		var compiled []*regexp.Regexp
+		for _, pattern := range list {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				compileErr = fmt.Errorf("challenge signature %q: invalid pattern %q: %w", signature.Name, pattern, err)
+				continue
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled
+	}
+
+	challenge := &compiledChallenge{
+		name:    signature.Name,
+		kind:    signature.Type,
+		title:   compileList(signature.Title),
+		html:    compileList(signature.HTML),
+		headers: make(map[string][]*regexp.Regexp),
+		require: compileList(signature.Require),
+		exclude: compileList(signature.Exclude),
+	}
+	for header, patterns := range signature.Headers {
+		challenge.headers[http.CanonicalHeaderKey(header)] = compileList(patterns)
+	}
+	if compileErr != nil {
+		return nil, compileErr
+	}
+	if len(challenge.title) == 0 && len(challenge.html) == 0 && len(challenge.headers) == 0 {
+		return nil, fmt.Errorf("challenge signature %q has no patterns", signature.Name)
+	}
+	return challenge, nil
+}
+
+// matches reports whether any pattern of the signature matches the page and
+// its HTML has every required and none of the excluded patterns
+func (c *compiledChallenge) matches(result ScanResult, title string) bool {
+	for _, re := range c.require {
+		if !re.MatchString(result.Content) {
+			return false
+		}
+	}
+	for _, re := range c.exclude {
+		if re.MatchString(result.Content) {
+			return false
+		}
+	}
+	for header, patterns := range c.headers {
+		for _, value := range result.Headers.Values(header) {
+			for _, re := range patterns {
+				if re.MatchString(value) {
+					return true
+				}
+			}
+		}
+	}
+	for _, re := range c.title {
+		if title != "" && re.MatchString(title) {
+			return true
+		}
+	}
+	for _, re := range c.html {
+		if re.MatchString(result.Content) {
+			return true
+		}
+	}
+	return false
+}
+
+// challengeSignals returns the title and the meta refresh of a page
+func challengeSignals(content string) (title, refresh string) {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return "", ""
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "title":
+				if title == "" {
+					title = strings.TrimSpace(nodeText(n))
+				}
+			case "meta":
+				if refresh == "" && strings.EqualFold(htmlAttr(n, "http-equiv"), "refresh") {
+					refresh = htmlAttr(n, "content")
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return title, refresh
+}
+
+// detectChallenge returns the first signature matching a fetched page
+func detectChallenge(rules *ChallengeRules, result ScanResult) *compiledChallenge {
+	if rules == nil || result.Status != "SUCCESS" {
+		return nil
+	}
+	title, _ := challengeSignals(result.Content)
+	for _, signature := range rules.signatures {
+		if signature.matches(result, title) {
+			return signature
+		}
+	}
+	return nil
+}
+
+// parseRefresh splits a Refresh header or meta refresh value such as
+// "5; url=/queue" into its delay and target
+func parseRefresh(value string) (time.Duration, string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, "", false
+	}
+	delay, target := value, ""
+	if i := strings.IndexAny(value, ";,"); i >= 0 {
+		delay, target = value[:i], value[i+1:]
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(delay), 64)
+	if err != nil || seconds < 0 {
+		return 0, "", false
+	}
+
+	target = strings.TrimSpace(target)
+	if len(target) >= 4 && strings.EqualFold(target[:3], "url") {
+		if rest := strings.TrimSpace(target[3:]); strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+	target = strings.Trim(target, `'"`)
+	return time.Duration(seconds * float64(time.Second)), target, true
+}
+
+// challengeRetry returns how long to wait before refetching a queue page and
+// which URL to fetch, following its refresh timer when it has one
+func challengeRetry(result ScanResult, maxWait time.Duration) (time.Duration, string) {
+	current := servedURL(result)
+	wait, next := defaultChallengeWait, current
+	refresh := result.Headers.Get("Refresh")
+	if refresh == "" {
+		_, refresh = challengeSignals(result.Content)
+	}
+	if delay, target, ok := parseRefresh(refresh); ok {
+		wait = delay
+		if target != "" {
+			if base, err := url.Parse(current); err == nil {
+				if resolved, err := base.Parse(target); err == nil && (resolved.Scheme == "http" || resolved.Scheme == "https") {
+					next = resolved.String()
+				}
+			}
+		}
+	}
+	if maxWait > 0 && wait > maxWait {
+		wait = maxWait
+	}
+	return wait, next
+}
+
+// retryable reports whether a challenge type can be waited out
+func retryable(kind string) bool {
+	return kind == ChallengeQueue || kind == ChallengeInterstitial
+}
+
+// resolveChallenge waits out a queue or interstitial page, refetching it up
+// to the configured number of times, and marks the result when it stays gated
+func resolveChallenge(client *http.Client, result ScanResult, target Target, settings challengeSettings) ScanResult {
+	signature := detectChallenge(settings.Rules, result)
+	if signature == nil {
+		return result
+	}
+	info := &ChallengeInfo{Name: signature.name, Type: signature.kind, Attempts: 1}
+
+	// Mocked targets would return the same page on every retry
+	for retryable(signature.kind) && target.MockResponse == "" && info.Attempts <= settings.Retries {
+		wait, next := challengeRetry(result, settings.MaxWait)
+		fmt.Printf("[INFO] %s is behind a %s (%s), retrying in %v (%d/%d)\n",
+			resultKey(result), signature.kind, signature.name, wait, info.Attempts, settings.Retries)
+		time.Sleep(wait)
+
+		result = rescanResult(client, result, next)
+		info.Attempts++
+
+		signature = detectChallenge(settings.Rules, result)
+		if signature == nil {
+			if result.Status == "SUCCESS" {
+				info.Passed = true
+				fmt.Printf("[INFO] %s passed the %s after %d attempts\n", resultKey(result), info.Type, info.Attempts)
+			}
+			result.Challenge = info
+			return result
+		}
+		info.Name, info.Type = signature.name, signature.kind
+	}
+
+	result.Status = "CHALLENGE"
+	result.Error = fmt.Sprintf("Gated by %s (%s)", info.Name, info.Type)
+	result.Challenge = info
+	fmt.Printf("[WARN] %s -> CHALLENGE (%s, %s)\n", resultKey(result), info.Name, info.Type)
+	return result
+}
+
+// handleChallenges detects queue, interstitial and CAPTCHA pages in a
+// finished scan, retries those that can be waited out and counts the
+// targets left gated. Crawled pages were resolved as they were fetched and
+// are only counted.
+func handleChallenges(client *http.Client, report *ScanReport, options analysisOptions) {
+	if options.Challenges.Rules == nil {
+		return
+	}
+	targets := make(map[string]Target)
+	for _, target := range options.Targets {
+		targets[target.CanonicalURL] = target
+	}
+
+	retried := false
+	report.Successful, report.Failed = 0, 0
+	for i := range report.Results {
+		result := report.Results[i]
+		if result.SeedURL == "" {
+			result = resolveChallenge(client, result, targets[resultKey(result)], options.Challenges)
+			report.Results[i] = result
+		}
+		retried = retried || (result.Challenge != nil && result.Challenge.Attempts > 1)
+
+		if result.Status == "SUCCESS" {
+			report.Successful++
+		} else {
+			report.Failed++
+		}
+	}
+
+	// Retries extend the scan
+	if retried {
+		report.EndTime = time.Now()
+	}
+	report.Gated = countGated(report.Results)
+	if report.Gated > 0 {
+		fmt.Printf("[WARN] %d targets are gated by anti-DDoS queues or CAPTCHAs\n", report.Gated)
+	}
+}
+
+// countGated returns the number of targets with a page left behind a
+// challenge; crawled pages count toward their seed
+func countGated(results []ScanResult) int {
+	gated := make(map[string]bool)
+	for _, result := range results {
+		if result.Status != "CHALLENGE" {
+			continue
+		}
+		key := result.SeedURL
+		if key == "" {
+			key = resultKey(result)
+		}
+		gated[key] = true
+	}
+	return len(gated)
+}
+
+// formatChallenge renders a challenge for the text report
+func formatChallenge(info *ChallengeInfo) string {
+	text := fmt.Sprintf("%s (%s), %d attempt(s)", info.Name, info.Type, info.Attempts)
+	if info.Passed {
+		text += ", passed"
+	}
+	return text
+}
+
+// generateChallengesSection lists the pages left gated by a challenge
+func generateChallengesSection(results []ScanResult) string {
+	section := ""
+	for _, result := range results {
+		if result.Status != "CHALLENGE" || result.Challenge == nil {
+			continue
+		}
+		section += fmt.Sprintf(`
+                    <tr>
+                        <td>%s</td>
+                        <td>%s</td>
+                        <td>%s</td>
+                        <td>%d</td>
+                    </tr>`,
+			escapeHTML(result.URL), escapeHTML(result.Challenge.Name), result.Challenge.Type, result.Challenge.Attempts)
+	}
+	if section == "" {
+		return ""
+	}
+
+	return `
+
+            <h2>🚧 Gated Targets</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>URL</th>
+                        <th>Challenge</th>
+                        <th>Type</th>
+                        <th>Attempts</th>
+                    </tr>
+                </thead>
+                <tbody>` + section + `
+                </tbody>
+            </table>`
+}
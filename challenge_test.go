@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDetectChallengeBuiltinSignatures(t *testing.T) {
+	rules, err := loadChallengeRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		headers http.Header
+		want    string
+	}{
+		{
+			name: "endgame queue",
+			content: `<html><head><title>Queue</title><meta http-equiv="refresh" content="10"></head>
+<body><div class="queue-box"><p>You are in the queue, please wait.</p></div><small>EndGame v3</small></body></html>`,
+			want: "EndGame queue",
+		},
+		{
+			name: "article about endgame queues",
+			content: `<html><head><title>Blog</title></head>
+<body><p>EndGame puts visitors in a queue before the site loads.</p></body></html>`,
+		},
+		{
+			name: "endgame captcha",
+			content: `<html><body><form method="post" class="kaptcha"><img src="/kaptcha.png">
+<input name="kaptcha" type="text"><button>Submit</button></form></body></html>`,
+			want: "EndGame captcha",
+		},
+		{
+			name: "captcha gate",
+			content: `<html><head><title>Security check</title></head>
+<body><form method="post"><img src="/captcha.php?id=3"><input name="captcha_code"><button>Enter</button></form></body></html>`,
+			want: "CAPTCHA form",
+		},
+		{
+			name: "login form with captcha",
+			content: `<html><head><title>Login</title></head>
+<body><form method="post" action="/login"><input name="username"><input name="password" type="password">
+<img src="/captcha.php"><input name="captcha"><button>Log in</button></form></body></html>`,
+		},
+		{
+			name: "contact form with captcha",
+			content: `<html><head><title>Contact</title></head>
+<body><form method="post"><textarea name="message"></textarea>
+<img src="/captcha.png"><input name="captcha"></form></body></html>`,
+		},
+		{
+			name:    "ddos-guard header",
+			content: `<html><head><title>Shop</title></head></html>`,
+			headers: http.Header{"Server": {"ddos-guard"}},
+			want:    "DDoS-Guard",
+		},
+		{
+			name:    "ordinary page",
+			content: `<html><head><title>Market</title></head><body><p>Welcome</p></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ScanResult{Status: "SUCCESS", Content: tt.content, Headers: tt.headers}
+			got := ""
+			if signature := detectChallenge(rules, result); signature != nil {
+				got = signature.name
+			}
+			if got != tt.want {
+				t.Errorf("detectChallenge() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChallengeRequireAndExclude(t *testing.T) {
+	challenge, err := compileChallenge(ChallengeSignature{
+		Name:    "Gate",
+		Type:    ChallengeQueue,
+		Title:   patternList{"^gate$"},
+		Require: patternList{"refresh"},
+		Exclude: patternList{"members only"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{`<meta http-equiv="refresh" content="5">`, true},
+		{`<p>no timer</p>`, false},
+		{`<meta http-equiv="refresh" content="5"><p>Members only</p>`, false},
+	}
+	for _, tt := range tests {
+		if got := challenge.matches(ScanResult{Content: tt.content}, "Gate"); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+	if challenge.matches(ScanResult{Content: `<meta http-equiv="refresh">`}, "Home") {
+		t.Errorf("matches() without a title, html or header hit = true, want false")
+	}
+}
+
+func TestCountGated(t *testing.T) {
+	results := []ScanResult{
+		{URL: "http://a.onion/", Status: "CHALLENGE"},
+		{URL: "http://a.onion/forum", SeedURL: "http://a.onion/", Status: "CHALLENGE"},
+		{URL: "http://b.onion/", Status: "SUCCESS"},
+		{URL: "http://c.onion/", CanonicalURL: "http://c.onion/", Status: "CHALLENGE"},
+	}
+	if got := countGated(results); got != 2 {
+		t.Errorf("countGated() = %d, want 2", got)
+	}
+}
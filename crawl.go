@@ -0,0 +1,256 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CrawlConfig limits how far crawl mode follows links from a seed target.
+// Unset values fall back to the crawl command's flags; depth 0 fetches only
+// the seed.
+type CrawlConfig struct {
+	Depth    *int     `yaml:"depth,omitempty"`
+	MaxPages int      `yaml:"max_pages,omitempty"`
+	Include  []string `yaml:"include,omitempty"`
+	Exclude  []string `yaml:"exclude,omitempty"`
+}
+
+// crawlScope is a compiled CrawlConfig for a single seed
+type crawlScope struct {
+	host     string
+	depth    int
+	maxPages int
+	include  []*regexp.Regexp
+	exclude  []*regexp.Regexp
+}
+
+// newCrawlScope merges a target's crawl settings over the defaults and
+// compiles its path filters
+func newCrawlScope(target Target, defaults CrawlConfig) (*crawlScope, error) {
+	config := defaults
+	if target.Crawl != nil {
+		if target.Crawl.Depth != nil {
+			config.Depth = target.Crawl.Depth
+		}
+		if target.Crawl.MaxPages > 0 {
+			config.MaxPages = target.Crawl.MaxPages
+		}
+		if len(target.Crawl.Include) > 0 {
+			config.Include = target.Crawl.Include
+		}
+		if len(target.Crawl.Exclude) > 0 {
+			config.Exclude = target.Crawl.Exclude
+		}
+	}
+
+	seed, err := url.Parse(target.CanonicalURL)
+	if err != nil || seed.Host == "" {
+		return nil, fmt.Errorf("invalid seed URL %q", target.CanonicalURL)
+	}
+
+	scope := &crawlScope{host: seed.Host, maxPages: config.MaxPages}
+	if config.Depth != nil {
+		if *config.Depth < 0 {
+			return nil, fmt.Errorf("invalid crawl depth %d", *config.Depth)
+		}
+		scope.depth = *config.Depth
+	}
+	for _, pattern := range config.Include {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		scope.include = append(scope.include, re)
+	}
+	for _, pattern := range config.Exclude {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+		scope.exclude = append(scope.exclude, re)
+	}
+	return scope, nil
+}
+
+// allows reports whether a canonical link is on the seed host and passes the
+// path filters, which match against the path and query
+func (s *crawlScope) allows(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || u.Host != s.host {
+		return false
+	}
+
+	target := u.EscapedPath()
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	for _, re := range s.exclude {
+		if re.MatchString(target) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, re := range s.include {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// crawlPage is a queued page with its position in the crawl tree. The page
+// is fetched from the link as written and identified by its canonical URL.
+type crawlPage struct {
+	url    string
+	link   string
+	parent string
+	depth  int
+}
+
+// crawlTarget fetches the seed target and follows same-host links breadth
+// first until the depth or page budget is exhausted. Challenge pages are
+// resolved as they are fetched, so links are only taken from the real page.
+func crawlTarget(client *http.Client, target Target, defaults CrawlConfig, challenges challengeSettings) []ScanResult {
+	scope, err := newCrawlScope(target, defaults)
+	if err != nil {
+		fmt.Printf("[ERR] Crawling %s -> %v\n", target.URL, err)
+		result := scanURL(client, target)
+		return []ScanResult{result}
+	}
+
+	var results []ScanResult
+	seen := map[string]bool{target.CanonicalURL: true}
+	queue := []crawlPage{{url: target.CanonicalURL, link: target.URL}}
+
+	for len(queue) > 0 && (scope.maxPages <= 0 || len(results) < scope.maxPages) {
+		page := queue[0]
+		queue = queue[1:]
+
+		// The seed keeps its own URL and mock response; linked pages are fetched as-is
+		pageTarget := target
+		if page.depth > 0 {
+			pageTarget = Target{URL: page.link, CanonicalURL: page.url, Name: target.Name, Type: target.Type, Tags: target.Tags}
+		}
+
+		result := resolveChallenge(client, scanURL(client, pageTarget), pageTarget, challenges)
+		result.SeedURL = target.CanonicalURL
+		result.ParentURL = page.parent
+		result.Depth = page.depth
+		results = append(results, result)
+
+		if page.depth >= scope.depth || !hasContent(result) || !isHTMLContent(result.ContentType) {
+			continue
+		}
+		// Relative links resolve against where any redirects ended up
+		base := requestURL(page.link)
+		if result.FinalURL != "" {
+			base = result.FinalURL
+		}
+		for _, link := range extractLinks(base, result.Content) {
+			canonical, err := normalizeURL(link.URL)
+			if err != nil || seen[canonical] || !scope.allows(canonical) {
+				continue
+			}
+			seen[canonical] = true
+			queue = append(queue, crawlPage{url: canonical, link: link.URL, parent: page.url, depth: page.depth + 1})
+		}
+	}
+
+	fmt.Printf("[INFO] Crawled %s: %d pages (%d queued links left)\n", target.CanonicalURL, len(results), len(queue))
+	return results
+}
+
+// runCrawlScan crawls every target and collects all pages into one report
+func runCrawlScan(client *http.Client, targets []Target, defaults CrawlConfig, challenges challengeSettings) ScanReport {
+	report := ScanReport{StartTime: time.Now()}
+
+	for _, target := range targets {
+		for _, result := range crawlTarget(client, target, defaults, challenges) {
+			report.Results = append(report.Results, result)
+			if result.Status == "SUCCESS" {
+				report.Successful++
+			} else {
+				report.Failed++
+			}
+		}
+	}
+
+	report.TotalURLs = len(report.Results)
+	report.EndTime = time.Now()
+	return report
+}
+
+// runCrawl implements the crawl subcommand
+func runCrawl(args []string) error {
+	fs := flag.NewFlagSet("crawl", flag.ExitOnError)
+	depth := fs.Int("depth", 1, "maximum link depth from each seed target")
+	maxPages := fs.Int("max-pages", 50, "maximum pages fetched per seed target (0 = unlimited)")
+	include := fs.String("include", "", "comma-separated regexes; only matching paths are followed")
+	exclude := fs.String("exclude", "", "comma-separated regexes; matching paths are skipped")
+	flags := addScanFlags(fs)
+	fs.Usage = func() {
+		fmt.Println("Usage: tor-scraper crawl [flags] <targets_file> [output_directory]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing targets file")
+	}
+	targetsFile := fs.Arg(0)
+	outputDir := "output"
+	if fs.NArg() > 1 {
+		outputDir = fs.Arg(1)
+	}
+
+	if err := flags.validate(); err != nil {
+		return err
+	}
+
+	defaults := CrawlConfig{Depth: depth, MaxPages: *maxPages}
+	if *include != "" {
+		defaults.Include = strings.Split(*include, ",")
+	}
+	if *exclude != "" {
+		defaults.Exclude = strings.Split(*exclude, ",")
+	}
+
+	fmt.Println("========================================")
+	fmt.Println("   Tor Scraper - Crawl Mode")
+	fmt.Println("========================================")
+	fmt.Println()
+
+	config, duplicates, options, err := loadScanConfig(targetsFile, flags)
+	if err != nil {
+		return err
+	}
+
+	client, err := createTorClient(options.Client)
+	if err != nil {
+		return fmt.Errorf("failed to create Tor client: %w", err)
+	}
+
+	scan := func(client *http.Client) ScanReport {
+		return runCrawlScan(client, config.Targets, defaults, options.Challenges)
+	}
+	report := runPipeline(client, options, duplicates, scan, loadPreviousReport(filepath.Join(outputDir, "scan_report.json")), true)
+
+	fmt.Printf("\n[INFO] Crawl complete: %d pages, %d successful\n\n", report.TotalURLs, report.Successful)
+
+	if err := saveRun(report, outputDir, outputDir); err != nil {
+		return err
+	}
+	if flags.checkFailOn(report) {
+		return errFailOn
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewCrawlScopeDepth(t *testing.T) {
+	defaultDepth, zero, three := 2, 0, 3
+	defaults := CrawlConfig{Depth: &defaultDepth, MaxPages: 50}
+	tests := []struct {
+		crawl *CrawlConfig
+		want  int
+	}{
+		{nil, 2},
+		{&CrawlConfig{MaxPages: 10}, 2},
+		{&CrawlConfig{Depth: &zero}, 0},
+		{&CrawlConfig{Depth: &three}, 3},
+	}
+	for _, tt := range tests {
+		target := Target{URL: "http://abc.onion/", CanonicalURL: "http://abc.onion/", Crawl: tt.crawl}
+		scope, err := newCrawlScope(target, defaults)
+		if err != nil {
+			t.Fatalf("newCrawlScope error: %v", err)
+		}
+		if scope.depth != tt.want {
+			t.Errorf("crawl %+v: depth = %d, want %d", tt.crawl, scope.depth, tt.want)
+		}
+	}
+
+	negative := -1
+	target := Target{URL: "http://abc.onion/", CanonicalURL: "http://abc.onion/", Crawl: &CrawlConfig{Depth: &negative}}
+	if _, err := newCrawlScope(target, defaults); err == nil {
+		t.Errorf("newCrawlScope with depth -1 succeeded, want error")
+	}
+}
+
+func TestCrawlScopeAllows(t *testing.T) {
+	target := Target{URL: "http://abc.onion/", CanonicalURL: "http://abc.onion/", Crawl: &CrawlConfig{
+		Include: []string{"^/forum"},
+		Exclude: []string{"/logout", "[?&]sort="},
+	}}
+	scope, err := newCrawlScope(target, CrawlConfig{})
+	if err != nil {
+		t.Fatalf("newCrawlScope error: %v", err)
+	}
+	tests := []struct {
+		link string
+		want bool
+	}{
+		{"http://abc.onion/forum/1", true},
+		{"http://abc.onion/forum/logout", false},
+		{"http://abc.onion/forum?sort=new", false},
+		{"http://abc.onion/market", false},
+		{"http://def.onion/forum/1", false},
+	}
+	for _, tt := range tests {
+		if got := scope.allows(tt.link); got != tt.want {
+			t.Errorf("allows(%q) = %v, want %v", tt.link, got, tt.want)
+		}
+	}
+}
+
+func TestCrawlTargetResolvesChallengesBeforeFollowingLinks(t *testing.T) {
+	visits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			visits++
+			if visits == 1 {
+				w.Write([]byte(`<html><head><title>Queue</title><meta http-equiv="refresh" content="0"></head>
+<body>Your position in queue: 3. <a href="/queue-faq">Why am I waiting?</a></body></html>`))
+				return
+			}
+			w.Write([]byte(`<html><body><a href="/forum">Forum</a></body></html>`))
+		default:
+			w.Write([]byte(`<html><body>` + r.URL.Path + `</body></html>`))
+		}
+	}))
+	defer server.Close()
+
+	rules, err := loadChallengeRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	depth := 1
+	target := withCanonicalURL(Target{URL: server.URL + "/"})
+	results := crawlTarget(&http.Client{}, target, CrawlConfig{Depth: &depth}, challengeSettings{Rules: rules, Retries: 1})
+
+	if len(results) != 2 {
+		t.Fatalf("crawled %d pages, want the seed and /forum", len(results))
+	}
+	seed := results[0]
+	if seed.Status != "SUCCESS" || seed.Challenge == nil || !seed.Challenge.Passed || seed.SeedURL != target.CanonicalURL {
+		t.Errorf("seed = %s %+v, want the queue passed", seed.Status, seed.Challenge)
+	}
+	if results[1].URL != server.URL+"/forum" || results[1].Depth != 1 {
+		t.Errorf("second page = %s at depth %d, want /forum from the page behind the queue", results[1].URL, results[1].Depth)
+	}
+
+	// The pipeline step leaves crawled pages as they are
+	report := ScanReport{Results: results}
+	handleChallenges(&http.Client{}, &report, analysisOptions{Targets: []Target{target}, Challenges: challengeSettings{Rules: rules, Retries: 1}})
+	if visits != 2 || report.Successful != 2 || report.Gated != 0 {
+		t.Errorf("after handleChallenges: %d visits, %d successful, %d gated", visits, report.Successful, report.Gated)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// defaultDaemonInterval is used when neither the config nor the flags set a schedule
+const defaultDaemonInterval = time.Hour
+
+// Schedule assigns a scan interval or cron expression to targets. A schedule
+// with neither Type nor Tag set is the default for all other targets.
+type Schedule struct {
+	Type     string `yaml:"type,omitempty"`
+	Tag      string `yaml:"tag,omitempty"`
+	Interval string `yaml:"interval,omitempty"`
+	Cron     string `yaml:"cron,omitempty"`
+}
+
+// scheduler computes the next run time after a given time
+type scheduler interface {
+	Next(t time.Time) time.Time
+	String() string
+}
+
+// intervalSchedule runs at a fixed interval
+type intervalSchedule time.Duration
+
+// Next returns t plus the interval
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// String returns the interval in Go duration format
+func (s intervalSchedule) String() string {
+	return "every " + time.Duration(s).String()
+}
+
+// parse turns the schedule's interval or cron expression into a scheduler
+func (s Schedule) parse() (scheduler, error) {
+	switch {
+	case s.Interval != "" && s.Cron != "":
+		return nil, fmt.Errorf("schedule must set either interval or cron, not both")
+	case s.Interval != "":
+		d, err := time.ParseDuration(s.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %w", s.Interval, err)
+		}
+		if d < time.Minute {
+			return nil, fmt.Errorf("interval %q is shorter than one minute", s.Interval)
+		}
+		return intervalSchedule(d), nil
+	case s.Cron != "":
+		return parseCron(s.Cron)
+	default:
+		return nil, fmt.Errorf("schedule must set an interval or cron expression")
+	}
+}
+
+// isDefault reports whether the schedule applies to all targets
+func (s Schedule) isDefault() bool {
+	return s.Type == "" && s.Tag == ""
+}
+
+// matches reports whether the schedule applies to the target
+func (s Schedule) matches(target Target) bool {
+	if s.Type != "" && s.Type != target.Type {
+		return false
+	}
+	if s.Tag != "" && !containsString(target.Tags, s.Tag) {
+		return false
+	}
+	return true
+}
+
+// daemonJob is a group of targets sharing one schedule
+type daemonJob struct {
+	schedule scheduler
+	targets  []Target
+	next     time.Time
+}
+
+// buildJobs groups targets by their first matching schedule. The override,
+// when set, replaces the default schedule from the config. Interval jobs run
+// right away when immediate is set, otherwise one interval from now.
+func buildJobs(config *YAMLConfig, override *Schedule, now time.Time, immediate bool) ([]*daemonJob, error) {
+	fallback := Schedule{Interval: defaultDaemonInterval.String()}
+	var rules []Schedule
+	for _, s := range config.Schedules {
+		if s.isDefault() {
+			fallback = s
+			continue
+		}
+		rules = append(rules, s)
+	}
+	if override != nil {
+		fallback = *override
+	}
+	rules = append(rules, fallback)
+
+	jobs := make([]*daemonJob, len(rules))
+	for i, rule := range rules {
+		sched, err := rule.parse()
+		if err != nil {
+			return nil, err
+		}
+		next := sched.Next(now)
+		if _, isInterval := sched.(intervalSchedule); isInterval && immediate {
+			next = now
+		}
+		jobs[i] = &daemonJob{schedule: sched, next: next}
+	}
+
+	for _, target := range config.Targets {
+		for i, rule := range rules {
+			if rule.matches(target) {
+				jobs[i].targets = append(jobs[i].targets, target)
+				break
+			}
+		}
+	}
+
+	// Drop schedules that no target uses
+	var active []*daemonJob
+	for _, job := range jobs {
+		if len(job.targets) > 0 {
+			active = append(active, job)
+		}
+	}
+	return active, nil
+}
+
+// runDaemon rescans targets on their schedules until interrupted, writing
+// each run into a timestamped subdirectory of the output directory
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	interval := fs.String("interval", "", "default scan interval (e.g. 30m, 6h)")
+	cronExpr := fs.String("cron", "", "default scan schedule as a 5-field cron expression")
+	flags := addScanFlags(fs)
+	fs.Usage = func() {
+		fmt.Println("Usage: tor-scraper daemon [flags] <targets_file> [output_directory]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing targets file")
+	}
+	targetsFile := fs.Arg(0)
+	outputDir := "output"
+	if fs.NArg() > 1 {
+		outputDir = fs.Arg(1)
+	}
+
+	if err := flags.validate(); err != nil {
+		return err
+	}
+
+	var override *Schedule
+	if *interval != "" || *cronExpr != "" {
+		override = &Schedule{Interval: *interval, Cron: *cronExpr}
+		if _, err := override.parse(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("========================================")
+	fmt.Println("   Tor Scraper - Daemon Mode")
+	fmt.Println("========================================")
+	fmt.Println()
+
+	config, duplicates, options, err := loadScanConfig(targetsFile, flags)
+	if err != nil {
+		return err
+	}
+	jobs, err := buildJobs(config, override, time.Now(), true)
+	if err != nil {
+		return err
+	}
+	printJobs(jobs)
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(reload)
+	defer signal.Stop(stop)
+
+	for {
+		next := nextJobTime(jobs)
+		if next.IsZero() {
+			fmt.Println("[WARN] No scheduled targets, waiting for SIGHUP...")
+		} else {
+			fmt.Printf("[INFO] Next scan at %s\n", next.Format("2006-01-02 15:04:05"))
+		}
+
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if !next.IsZero() {
+			timer = time.NewTimer(time.Until(next))
+			fire = timer.C
+		}
+
+		select {
+		case sig := <-stop:
+			fmt.Printf("[INFO] Received %v, shutting down daemon\n", sig)
+			return nil
+
+		case <-reload:
+			fmt.Println("[INFO] Received SIGHUP, reloading targets...")
+			newJobs, newDuplicates, newOptions, err := reloadJobs(targetsFile, flags, override)
+			if err != nil {
+				fmt.Printf("[ERR] Reload failed, keeping previous schedules: %v\n", err)
+			} else {
+				duplicates, jobs, options = newDuplicates, newJobs, newOptions
+				printJobs(jobs)
+			}
+
+		case now := <-fire:
+			var due []Target
+			for _, job := range jobs {
+				if !job.next.IsZero() && !job.next.After(now) {
+					due = append(due, job.targets...)
+					job.next = job.schedule.Next(now)
+				}
+			}
+			runDaemonScan(due, options, flags, duplicates, outputDir, now)
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// reloadJobs re-reads the targets file and its watchlist and rebuilds the schedules
+func reloadJobs(targetsFile string, flags *scanFlags, override *Schedule) ([]*daemonJob, []DuplicateTarget, analysisOptions, error) {
+	config, duplicates, options, err := loadScanConfig(targetsFile, flags)
+	if err != nil {
+		return nil, nil, analysisOptions{}, err
+	}
+	jobs, err := buildJobs(config, override, time.Now(), false)
+	if err != nil {
+		return nil, nil, analysisOptions{}, err
+	}
+	return jobs, duplicates, options, nil
+}
+
+// runDaemonScan performs a single scheduled run of the due targets; options
+// holds all configured targets. Errors and panics are logged so the daemon
+// keeps running, and reaching the -fail-on severity only raises an alert.
+func runDaemonScan(targets []Target, options analysisOptions, flags *scanFlags, duplicates []DuplicateTarget, outputDir string, now time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("[ERR] Scheduled scan aborted: %v\n", r)
+		}
+	}()
+
+	if len(targets) == 0 {
+		return
+	}
+
+	runDir := filepath.Join(outputDir, now.Format("20060102-150405"))
+	fmt.Printf("[INFO] Starting scheduled scan of %d targets -> %s\n", len(targets), runDir)
+
+	client, err := createTorClient(options.Client)
+	if err != nil {
+		fmt.Printf("[ERR] Failed to create Tor client: %v\n", err)
+		return
+	}
+
+	// Scheduled runs cover only the due targets, so missing ones are not "removed"
+	scan := func(client *http.Client) ScanReport { return runScan(client, targets) }
+	report := runPipeline(client, options, duplicates, scan, previousTargetResults(outputDir, targets), false)
+	if err := saveRun(report, outputDir, runDir); err != nil {
+		fmt.Printf("[ERR] %v\n", err)
+		return
+	}
+	fmt.Printf("[SUCCESS] Scheduled scan complete: %d/%d successful\n", report.Successful, report.TotalURLs)
+	flags.checkFailOn(report)
+}
+
+// previousTargetResults builds the report a scheduled run is compared with:
+// each due target's result from the latest earlier run that scanned it, found
+// through the results database. Jobs on other schedules write runs in
+// between, so the newest run directory is not a baseline on its own.
+func previousTargetResults(outputDir string, targets []Target) *ScanReport {
+	db, err := openDatabase(filepath.Join(outputDir, databaseFileName), true)
+	if err != nil {
+		// No run has been recorded yet
+		return nil
+	}
+	defer db.Close()
+
+	runs, err := listRuns(db)
+	if err != nil {
+		fmt.Printf("[WARN] Skipping change detection: %v\n", err)
+		return nil
+	}
+	runDirs := make(map[uint64]string)
+	for _, run := range runs {
+		runDirs[run.ID] = run.OutputDir
+	}
+
+	previous := &ScanReport{}
+	reports := make(map[string]*ScanReport)
+	for _, target := range targets {
+		stored, err := queryResults(db, resultFilter{URL: target.CanonicalURL})
+		if err != nil {
+			fmt.Printf("[WARN] Skipping change detection for %s: %v\n", target.URL, err)
+			continue
+		}
+		if len(stored) == 0 {
+			continue
+		}
+
+		// Stored results are in run order, so the last one is the latest
+		runDir := runDirs[stored[len(stored)-1].RunID]
+		report, ok := reports[runDir]
+		if !ok {
+			report = loadPreviousReport(filepath.Join(runDir, "scan_report.json"))
+			reports[runDir] = report
+		}
+		if report == nil {
+			continue
+		}
+		for _, result := range report.Results {
+			if resultKey(result) != target.CanonicalURL {
+				continue
+			}
+			previous.Results = append(previous.Results, result)
+			// Changes are reported since the oldest baseline used
+			if previous.EndTime.IsZero() || report.EndTime.Before(previous.EndTime) {
+				previous.EndTime = report.EndTime
+			}
+			break
+		}
+	}
+	if len(previous.Results) == 0 {
+		return nil
+	}
+	return previous
+}
+
+// nextJobTime returns the earliest next run time across all jobs. Jobs
+// without a next run time are skipped.
+func nextJobTime(jobs []*daemonJob) time.Time {
+	var next time.Time
+	for _, job := range jobs {
+		if job.next.IsZero() {
+			continue
+		}
+		if next.IsZero() || job.next.Before(next) {
+			next = job.next
+		}
+	}
+	return next
+}
+
+// printJobs logs the active schedules and how many targets each covers
+func printJobs(jobs []*daemonJob) {
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].next.Before(jobs[j].next) })
+	for _, job := range jobs {
+		fmt.Printf("[INFO] Schedule %s: %d targets\n", job.schedule, len(job.targets))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreviousTargetResultsPerTarget(t *testing.T) {
+	outputDir := t.TempDir()
+	hourly := withCanonicalURL(Target{URL: "http://hourly.onion/"})
+	daily := withCanonicalURL(Target{URL: "http://daily.onion/"})
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	run := func(at time.Time, target Target, content string) {
+		t.Helper()
+		report := ScanReport{
+			StartTime: at, EndTime: at.Add(time.Minute), TotalURLs: 1, Successful: 1,
+			Results: []ScanResult{{
+				URL: target.URL, CanonicalURL: target.CanonicalURL,
+				Status: "SUCCESS", StatusCode: 200, Content: content, Timestamp: at,
+			}},
+		}
+		if err := saveRun(report, outputDir, filepath.Join(outputDir, at.Format("20060102-150405"))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run(start, daily, "daily v1")
+	run(start.Add(time.Hour), hourly, "hourly v1")
+	run(start.Add(2*time.Hour), hourly, "hourly v2")
+
+	previous := previousTargetResults(outputDir, []Target{daily, hourly})
+	if previous == nil {
+		t.Fatalf("previousTargetResults() = nil, want results for both targets")
+	}
+	contents := make(map[string]string)
+	for _, result := range previous.Results {
+		contents[resultKey(result)] = result.Content
+	}
+	if contents[daily.CanonicalURL] != "daily v1" || contents[hourly.CanonicalURL] != "hourly v2" {
+		t.Errorf("baselines = %v, want each target's own latest result", contents)
+	}
+	if !previous.EndTime.Equal(start.Add(time.Minute)) {
+		t.Errorf("end time = %v, want the oldest baseline's", previous.EndTime)
+	}
+
+	// The daily target is compared with its own run, not the newer hourly one
+	current := ScanReport{Results: []ScanResult{{URL: daily.URL, CanonicalURL: daily.CanonicalURL, Status: "SUCCESS", StatusCode: 200, Content: "daily v1"}}}
+	changes := diffReports(*previous, current, false)
+	if len(changes) != 1 || changes[0].Change != ChangeUnchanged {
+		t.Errorf("changes = %+v, want the daily target unchanged", changes)
+	}
+
+	if got := previousTargetResults(outputDir, []Target{withCanonicalURL(Target{URL: "http://new.onion/"})}); got != nil {
+		t.Errorf("previousTargetResults(new target) = %+v, want nil", got)
+	}
+	if got := previousTargetResults(t.TempDir(), []Target{daily}); got != nil {
+		t.Errorf("previousTargetResults(no database) = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Change classifications for a target between two scans
+const (
+	ChangeNew       = "new"
+	ChangeRemoved   = "removed"
+	ChangeChanged   = "changed"
+	ChangeUnchanged = "unchanged"
+)
+
+const (
+	// diffContextLines is the number of unchanged lines shown around each change
+	diffContextLines = 3
+	// maxDiffEdits bounds the diff search; larger changes are shown as a full replacement
+	maxDiffEdits = 2000
+)
+
+// ContentChange describes how a target's content differs from a previous scan
+type ContentChange struct {
+	URL     string `json:"url"`
+	Name    string `json:"name,omitempty"`
+	Change  string `json:"change"`
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+	Note    string `json:"note,omitempty"`
+	Diff    string `json:"diff,omitempty"`
+}
+
+// loadScanReport reads a JSON scan report written by saveScanReport
+func loadScanReport(path string) (*ScanReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report ScanReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// contentHash returns the SHA-256 of the page's normalized visible text, so
+// markup-only and whitespace changes do not count as content changes
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(extractText(content))))
+	return hex.EncodeToString(sum[:])
+}
+
+// hasContent reports whether a result carries a fetched page to compare
+func hasContent(result ScanResult) bool {
+	return result.Status == "SUCCESS" && result.Content != ""
+}
+
+// diffReports compares the current report with a previous one by canonical
+// URL. Targets only in the previous report are listed as removed when
+// includeRemoved is set.
+func diffReports(previous, current ScanReport, includeRemoved bool) []ContentChange {
+	old := make(map[string]ScanResult)
+	for _, result := range previous.Results {
+		old[resultKey(result)] = result
+	}
+
+	var changes []ContentChange
+	seen := make(map[string]bool)
+	for _, result := range current.Results {
+		key := resultKey(result)
+		seen[key] = true
+		change := ContentChange{URL: key, Name: result.Name}
+
+		before, existed := old[key]
+		switch {
+		case !existed:
+			change.Change = ChangeNew
+			if hasContent(result) {
+				change.NewHash = contentHash(result.Content)
+			}
+		case !hasContent(result) || !hasContent(before):
+			// Without content on both sides a fetch failure is not a content change
+			change.Change = ChangeUnchanged
+			change.Note = fmt.Sprintf("not compared: status %s -> %s", before.Status, result.Status)
+		default:
+			change.OldHash = contentHash(before.Content)
+			change.NewHash = contentHash(result.Content)
+			if change.OldHash == change.NewHash {
+				change.Change = ChangeUnchanged
+			} else {
+				change.Change = ChangeChanged
+				change.Diff = unifiedDiff(extractText(before.Content), extractText(result.Content),
+					key+" ("+before.Timestamp.Format("2006-01-02 15:04:05")+")",
+					key+" ("+result.Timestamp.Format("2006-01-02 15:04:05")+")")
+			}
+		}
+		changes = append(changes, change)
+	}
+
+	if includeRemoved {
+		var removed []string
+		for key := range old {
+			if !seen[key] {
+				removed = append(removed, key)
+			}
+		}
+		sort.Strings(removed)
+		for _, key := range removed {
+			change := ContentChange{URL: key, Name: old[key].Name, Change: ChangeRemoved}
+			if hasContent(old[key]) {
+				change.OldHash = contentHash(old[key].Content)
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// countChanges tallies changes by classification
+func countChanges(changes []ContentChange) map[string]int {
+	counts := make(map[string]int)
+	for _, change := range changes {
+		counts[change.Change]++
+	}
+	return counts
+}
+
+// loadPreviousReport reads the report a scan is compared with, or returns
+// nil when there is none
+func loadPreviousReport(path string) *ScanReport {
+	previous, err := loadScanReport(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("[WARN] Skipping change detection: %v\n", err)
+		}
+		return nil
+	}
+	return previous
+}
+
+// attachChanges compares the report with the previous report and stores
+// the result on the report
+func attachChanges(report *ScanReport, previous ScanReport, includeRemoved bool) {
+	report.Changes = diffReports(previous, *report, includeRemoved)
+	counts := countChanges(report.Changes)
+	fmt.Printf("[INFO] Changes since %s: %d new, %d changed, %d removed, %d unchanged\n",
+		previous.EndTime.Format("2006-01-02 15:04:05"),
+		counts[ChangeNew], counts[ChangeChanged], counts[ChangeRemoved], counts[ChangeUnchanged])
+}
+
+// writeContentDiff writes the unified diffs of all changed pages to a text
+// file, removing any stale file when nothing changed
+func writeContentDiff(changes []ContentChange, path string) error {
+	var sb strings.Builder
+	for _, change := range changes {
+		if change.Diff == "" {
+			continue
+		}
+		sb.WriteString(change.Diff)
+		sb.WriteString("\n")
+	}
+	if sb.Len() == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale content diff: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write content diff: %w", err)
+	}
+	return nil
+}
+
+// generateChangesSection renders the change detection results for the HTML report
+func generateChangesSection(changes []ContentChange) string {
+	if len(changes) == 0 {
+		return ""
+	}
+
+	counts := countChanges(changes)
+	section := fmt.Sprintf(`
+
+            <h2>🔄 Changes Since Previous Scan</h2>
+            <p>%d new, %d changed, %d removed, %d unchanged</p>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>URL</th>
+                        <th>Change</th>
+                        <th>Diff</th>
+                    </tr>
+                </thead>
+                <tbody>`,
+		counts[ChangeNew], counts[ChangeChanged], counts[ChangeRemoved], counts[ChangeUnchanged])
+
+	for _, change := range changes {
+		if change.Change == ChangeUnchanged {
+			continue
+		}
+		diff := ""
+		if change.Diff != "" {
+			diff = "<pre>" + html.EscapeString(change.Diff) + "</pre>"
+		}
+		section += fmt.Sprintf(`
+                    <tr>
+                        <td><strong>%s</strong></td>
+                        <td>%s</td>
+                        <td>%s</td>
+                    </tr>`,
+			html.EscapeString(change.URL), change.Change, diff)
+	}
+
+	section += `
+                </tbody>
+            </table>`
+	return section
+}
+
+// runDiff compares two saved JSON reports and prints the changes
+func runDiff(args []string) error {
+	if len(args) < 2 {
+		fmt.Println("Usage: tor-scraper diff <old_report.json> <new_report.json> [output_directory]")
+		return fmt.Errorf("missing report files")
+	}
+
+	previous, err := loadScanReport(args[0])
+	if err != nil {
+		return err
+	}
+	current, err := loadScanReport(args[1])
+	if err != nil {
+		return err
+	}
+
+	changes := diffReports(*previous, *current, true)
+	for _, change := range changes {
+		fmt.Printf("%-10s %s\n", strings.ToUpper(change.Change), change.URL)
+	}
+	counts := countChanges(changes)
+	fmt.Printf("\n%d new, %d changed, %d removed, %d unchanged\n\n",
+		counts[ChangeNew], counts[ChangeChanged], counts[ChangeRemoved], counts[ChangeUnchanged])
+
+	for _, change := range changes {
+		if change.Diff != "" {
+			fmt.Println(change.Diff)
+		}
+	}
+
+	if len(args) > 2 {
+		outputDir := args[2]
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		changesJSON, err := json.MarshalIndent(changes, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal changes: %w", err)
+		}
+		changesPath := filepath.Join(outputDir, "changes.json")
+		if err := os.WriteFile(changesPath, changesJSON, 0644); err != nil {
+			return fmt.Errorf("failed to write changes: %w", err)
+		}
+		fmt.Printf("[INFO] Changes saved to: %s\n", changesPath)
+
+		diffPath := filepath.Join(outputDir, "content_diff.txt")
+		if err := writeContentDiff(changes, diffPath); err != nil {
+			return err
+		}
+		if counts[ChangeChanged] > 0 {
+			fmt.Printf("[INFO] Content diff saved to: %s\n", diffPath)
+		}
+	}
+
+	return nil
+}
+
+// diffOp is a single line in an edit script
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// unifiedDiff returns a unified diff between two texts, compared line by line
+func unifiedDiff(oldText, newText, oldName, newName string) string {
+	a := splitLines(oldText)
+	b := splitLines(newText)
+	ops := diffLines(a, b)
+
+	var sb strings.Builder
+	sb.WriteString("--- " + oldName + "\n")
+	sb.WriteString("+++ " + newName + "\n")
+
+	// Group the edit script into hunks with surrounding context
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			// Stop once the next change is further than two contexts away
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContextLines {
+				end += diffContextLines
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = next
+		}
+
+		oldStart, newStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				oldStart++
+			}
+			if op.kind != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+		// An empty range is numbered by the line before it
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+		sb.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.text)
+			sb.WriteByte('\n')
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// splitLines splits text into lines, returning nil for empty text
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines computes a shortest edit script between a and b using Myers'
+// algorithm. When more than maxDiffEdits edits are needed the whole text is
+// reported as replaced.
+func diffLines(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+	limit := max
+	if limit > maxDiffEdits {
+		limit = maxDiffEdits
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	found := false
+
+	for d := 0; d <= limit && !found; d++ {
+		// Round d only reads diagonals -d..d, so only that window is kept;
+		// copying all of v would cost O(limit*(n+m)) memory on large pages
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		ops := make([]diffOp, 0, n+m)
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+		return ops
+	}
+
+	// Walk the trace backwards to recover the edit script
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		// The snapshot of round d holds diagonal k at index k+d
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d] < v[k+1+d]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v[prevK+d]
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
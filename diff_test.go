@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// applyOps rebuilds both sides of an edit script
+func applyOps(ops []diffOp) (a, b []string) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			a = append(a, op.text)
+		}
+		if op.kind != '-' {
+			b = append(b, op.text)
+		}
+	}
+	return a, b
+}
+
+func countEdits(ops []diffOp) int {
+	edits := 0
+	for _, op := range ops {
+		if op.kind != ' ' {
+			edits++
+		}
+	}
+	return edits
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		edits int
+	}{
+		{"", "", 0},
+		{"a", "", 1},
+		{"", "a", 1},
+		{"a\nb\nc", "a\nb\nc", 0},
+		{"a\nb\nc", "a\nx\nc", 2},
+		{"a\nb\nc", "a\nc", 1},
+		{"a\nc", "a\nb\nc", 1},
+		{"a\nb\nc\na\nb\nb\na", "c\nb\na\nb\na\nc", 5},
+		{"x\ny", "a\nb", 4},
+	}
+	for _, tt := range tests {
+		a, b := splitLines(tt.a), splitLines(tt.b)
+		ops := diffLines(a, b)
+		gotA, gotB := applyOps(ops)
+		if strings.Join(gotA, "\n") != tt.a || strings.Join(gotB, "\n") != tt.b {
+			t.Errorf("diffLines(%q, %q) = %v does not rebuild both sides", tt.a, tt.b, ops)
+		}
+		if got := countEdits(ops); got != tt.edits {
+			t.Errorf("diffLines(%q, %q) has %d edits, want %d", tt.a, tt.b, got, tt.edits)
+		}
+	}
+}
+
+func TestDiffLinesLargeInput(t *testing.T) {
+	a := make([]string, 20000)
+	for i := range a {
+		a[i] = fmt.Sprintf("line %d", i)
+	}
+	b := append([]string(nil), a...)
+	for i := 0; i < len(b); i += 1000 {
+		b[i] = "changed"
+	}
+	ops := diffLines(a, b)
+	gotA, gotB := applyOps(ops)
+	if len(gotA) != len(a) || len(gotB) != len(b) {
+		t.Fatalf("edit script rebuilds %d and %d lines, want %d", len(gotA), len(gotB), len(a))
+	}
+	if got := countEdits(ops); got != 40 {
+		t.Errorf("got %d edits, want 40", got)
+	}
+}
+
+func TestDiffLinesOverLimit(t *testing.T) {
+	var a, b []string
+	for i := 0; i < maxDiffEdits; i++ {
+		a = append(a, fmt.Sprintf("old %d", i))
+		b = append(b, fmt.Sprintf("new %d", i))
+	}
+	ops := diffLines(a, b)
+	if len(ops) != len(a)+len(b) {
+		t.Fatalf("got %d ops, want a full replacement of %d", len(ops), len(a)+len(b))
+	}
+	if ops[0].kind != '-' || ops[len(ops)-1].kind != '+' {
+		t.Errorf("full replacement should remove the old lines before adding the new ones")
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	got := unifiedDiff("a\nb\nc", "a\nx\nc", "old", "new")
+	want := "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"
+	if got != want {
+		t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+}
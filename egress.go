@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// EgressPolicy decides which hosts the Tor client may connect to. Onion
+// hosts are always allowed; clearnet hosts only when allowlisted.
+type EgressPolicy struct {
+	// ClearnetAllow lists the clearnet hostnames that may be contacted.
+	// "*.example.com" also matches subdomains and "*" matches any hostname.
+	ClearnetAllow []string
+}
+
+// egressBlockedError is a connection refused by the egress policy
+type egressBlockedError struct {
+	address string
+	reason  string
+}
+
+func (e *egressBlockedError) Error() string {
+	return fmt.Sprintf("egress to %s blocked: %s", e.address, e.reason)
+}
+
+// newEgressPolicy builds the egress policy from the config's clearnet allowlist
+func newEgressPolicy(config *YAMLConfig) (EgressPolicy, error) {
+	var policy EgressPolicy
+	for _, pattern := range config.ClearnetAllow {
+		pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "."))
+		host := strings.TrimPrefix(pattern, "*.")
+		if pattern == "" || (pattern != "*" && strings.ContainsAny(host, "*/:")) {
+			return policy, fmt.Errorf("invalid clearnet_allow entry %q", pattern)
+		}
+		if net.ParseIP(host) != nil {
+			return policy, fmt.Errorf("clearnet_allow entry %q is an IP address; raw IP destinations are never allowed", pattern)
+		}
+		policy.ClearnetAllow = append(policy.ClearnetAllow, pattern)
+	}
+	return policy, nil
+}
+
+// allowsHost reports whether a clearnet hostname matches the allowlist
+func (p EgressPolicy) allowsHost(host string) bool {
+	for _, pattern := range p.ClearnetAllow {
+		switch {
+		case pattern == "*":
+			return true
+		case strings.HasPrefix(pattern, "*."):
+			if host == pattern[2:] || strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		case host == pattern:
+			return true
+		}
+	}
+	return false
+}
+
+// check refuses connections to raw IP addresses and to clearnet hosts
+// missing from the allowlist
+func (p EgressPolicy) check(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return &egressBlockedError{address: address, reason: "invalid address"}
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	if net.ParseIP(host) != nil {
+		return &egressBlockedError{address: address, reason: "raw IP destinations are not allowed"}
+	}
+	if strings.HasSuffix(host, ".onion") || p.allowsHost(host) {
+		return nil
+	}
+	return &egressBlockedError{address: address, reason: "clearnet host is not in clearnet_allow"}
+}
+
+// isEgressBlocked reports whether an error comes from the egress policy
+func isEgressBlocked(err error) bool {
+	var blocked *egressBlockedError
+	return errors.As(err, &blocked)
+}
+
+// torOnlyForward is the SOCKS5 dialer's forward dialer. It dials nothing
+// but the Tor proxy itself, so no connection can bypass Tor.
+type torOnlyForward struct {
+	proxyAddr string
+}
+
+func (f torOnlyForward) Dial(network, address string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, address)
+}
+
+func (f torOnlyForward) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if address != f.proxyAddr {
+		return nil, &egressBlockedError{address: address, reason: "only the Tor SOCKS proxy may be dialed directly"}
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
+
+// disableLocalDNS makes every local name lookup fail. Hostnames are handed
+// unresolved to the SOCKS5 proxy, which sends them to Tor as domain names,
+// so any lookup attempted here would be a DNS leak.
+func disableLocalDNS() {
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, &egressBlockedError{address: address, reason: "local DNS resolution is disabled"}
+		},
+	}
+}
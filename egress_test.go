@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"golang.org/x/net/proxy"
+)
+
+func TestEgressPolicyCheck(t *testing.T) {
+	policy, err := newEgressPolicy(&YAMLConfig{ClearnetAllow: []string{"Check.TorProject.org.", "*.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{testOnionV3 + ".onion:80", true},
+		{"www." + testOnionV3 + ".ONION:443", true},
+		{"abc.onion.:80", true},
+		{"check.torproject.org:443", true},
+		{"CHECK.TORPROJECT.ORG.:443", true},
+		{"torproject.org:443", false},
+		{"example.com:443", true},
+		{"a.b.example.com:443", true},
+		{"badexample.com:443", false},
+		{"example.com.evil.net:443", false},
+		{"185.220.101.1:80", false},
+		{"127.0.0.1:9050", false},
+		{"[2606:4700::1111]:443", false},
+		{"[::1]:80", false},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		err := policy.check(tt.address)
+		if (err == nil) != tt.allowed {
+			t.Errorf("check(%s) = %v, want allowed: %v", tt.address, err, tt.allowed)
+		}
+		if err != nil && !isEgressBlocked(err) {
+			t.Errorf("check(%s) = %v, want an egress block", tt.address, err)
+		}
+	}
+
+	if err := (EgressPolicy{}).check("example.org:80"); err == nil {
+		t.Errorf("empty policy allowed a clearnet host")
+	}
+	if err := (EgressPolicy{ClearnetAllow: []string{"*"}}).check("example.org:80"); err != nil {
+		t.Errorf("wildcard policy blocked a clearnet host: %v", err)
+	}
+	if err := (EgressPolicy{ClearnetAllow: []string{"*"}}).check("8.8.8.8:53"); err == nil {
+		t.Errorf("wildcard policy allowed a raw IP")
+	}
+}
+
+func TestNewEgressPolicyRejectsInvalidEntries(t *testing.T) {
+	for _, entry := range []string{"", " ", "1.2.3.4", "*.10.0.0.1", "::1", "example.com:443", "https://example.com", "a.*.example.com", "**.example.com"} {
+		if _, err := newEgressPolicy(&YAMLConfig{ClearnetAllow: []string{entry}}); err == nil {
+			t.Errorf("newEgressPolicy(%q) succeeded, want an error", entry)
+		}
+	}
+}
+
+func TestTorOnlyForward(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	forward := torOnlyForward{proxyAddr: listener.Addr().String()}
+	conn, err := forward.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial(proxy) = %v", err)
+	}
+	conn.Close()
+
+	for _, address := range []string{"127.0.0.1:80", "example.com:443", testOnionV3 + ".onion:80"} {
+		if _, err := forward.Dial("tcp", address); !isEgressBlocked(err) {
+			t.Errorf("Dial(%s) = %v, want an egress block", address, err)
+		}
+	}
+}
+
+func TestSOCKS5SendsHostnames(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	host := testOnionV3 + ".onion"
+	requests := make(chan []byte, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// Greeting: version, method count, methods
+		greeting := make([]byte, 2)
+		if _, err := io.ReadFull(conn, greeting); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, make([]byte, greeting[1])); err != nil {
+			return
+		}
+		conn.Write([]byte{0x05, 0x00})
+
+		// Request: version, command, reserved, address type, then the address
+		request := make([]byte, 4)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		requests <- request
+		if request[3] == 0x03 {
+			length := make([]byte, 1)
+			io.ReadFull(conn, length)
+			name := make([]byte, int(length[0])+2)
+			io.ReadFull(conn, name)
+			requests <- name[:length[0]]
+		}
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	}()
+
+	proxyAddr := listener.Addr().String()
+	dialer, err := proxy.SOCKS5("tcp", proxyAddr, nil, torOnlyForward{proxyAddr: proxyAddr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := dialer.Dial("tcp", host+":80")
+	if err != nil {
+		t.Fatalf("Dial(%s) = %v", host, err)
+	}
+	conn.Close()
+
+	request := <-requests
+	if request[1] != 0x01 || request[3] != 0x03 {
+		t.Fatalf("SOCKS5 request = % x, want CONNECT with address type 0x03 (domain name)", request)
+	}
+	if name := <-requests; !bytes.Equal(name, []byte(host)) {
+		t.Errorf("SOCKS5 domain = %q, want %q", name, host)
+	}
+}
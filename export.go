@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+)
+
+// runExport implements the export subcommand, converting a saved scan report
+// into a threat intelligence exchange format
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "stix", "export format: stix or misp")
+	info := fs.String("info", "", "MISP event title (default: scan date)")
+	distribution := fs.Int("distribution", 0, "MISP event distribution: 0 organisation, 1 community, 2 connected, 3 all")
+	threatLevel := fs.Int("threat-level", 4, "MISP threat level: 1 high, 2 medium, 3 low, 4 undefined")
+	analysis := fs.Int("analysis", 0, "MISP analysis state: 0 initial, 1 ongoing, 2 completed")
+	fs.Usage = func() {
+		fmt.Println("Usage: tor-scraper export [flags] <scan_report.json> [output_file]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing report file")
+	}
+	reportPath := fs.Arg(0)
+
+	report, err := loadScanReport(reportPath)
+	if err != nil {
+		return err
+	}
+	if len(report.Results) == 0 {
+		return fmt.Errorf("report %s has no results", reportPath)
+	}
+	// Reports saved before indicator extraction existed get it now
+	if len(report.IOCs) == 0 {
+		for i := range report.Results {
+			report.Results[i].IOCs = extractIOCs(report.Results[i])
+		}
+		report.IOCs = collectIOCs(report.Results)
+	}
+
+	switch *format {
+	case "stix":
+		outputPath := filepath.Join(filepath.Dir(reportPath), "stix_bundle.json")
+		if fs.NArg() > 1 {
+			outputPath = fs.Arg(1)
+		}
+		if err := writeSTIXBundle(*report, outputPath); err != nil {
+			return err
+		}
+		fmt.Printf("[INFO] STIX 2.1 bundle saved to: %s\n", outputPath)
+	case "misp":
+		if *distribution < 0 || *distribution > 3 {
+			return fmt.Errorf("distribution %d is not between 0 and 3", *distribution)
+		}
+		if *threatLevel < 1 || *threatLevel > 4 {
+			return fmt.Errorf("threat level %d is not between 1 and 4", *threatLevel)
+		}
+		if *analysis < 0 || *analysis > 2 {
+			return fmt.Errorf("analysis %d is not between 0 and 2", *analysis)
+		}
+		outputPath := filepath.Join(filepath.Dir(reportPath), "misp_event.json")
+		if fs.NArg() > 1 {
+			outputPath = fs.Arg(1)
+		}
+		options := MISPOptions{Info: *info, Distribution: *distribution, ThreatLevelID: *threatLevel, Analysis: *analysis}
+		if err := writeMISPEvent(*report, options, outputPath); err != nil {
+			return err
+		}
+		fmt.Printf("[INFO] MISP event saved to: %s\n", outputPath)
+	default:
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// skippedTextElements are elements whose text is never visible on the page
+var skippedTextElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+}
+
+// blockElements start a new line in the extracted text
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true,
+	"table": true, "td": true, "th": true, "tr": true, "ul": true,
+}
+
+// extractText returns the visible text of an HTML document, one block per
+// line with whitespace collapsed and empty lines removed
+func extractText(content string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return normalizeWhitespace(content)
+	}
+
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && skippedTextElements[n.Data] {
+			return
+		}
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+		block := n.Type == html.ElementNode && blockElements[n.Data]
+		if block {
+			sb.WriteByte('\n')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if block {
+			sb.WriteByte('\n')
+		}
+	}
+	walk(doc)
+
+	return normalizeWhitespace(sb.String())
+}
+
+// normalizeWhitespace collapses runs of spaces within each line and drops
+// empty lines
+func normalizeWhitespace(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// PageLink is a hyperlink found on a page
+type PageLink struct {
+	URL  string
+	Text string
+}
+
+// extractLinks returns the absolute http(s) links of an HTML document,
+// resolved against the page URL or its <base href>
+func extractLinks(pageURL, content string) []PageLink {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var links []PageLink
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			var ref string
+			switch n.Data {
+			case "base":
+				if href := htmlAttr(n, "href"); href != "" {
+					if resolved, err := base.Parse(href); err == nil {
+						base = resolved
+					}
+				}
+			case "a", "area":
+				ref = htmlAttr(n, "href")
+			case "frame", "iframe":
+				ref = htmlAttr(n, "src")
+			}
+			if ref = strings.TrimSpace(ref); ref != "" {
+				if resolved, err := base.Parse(ref); err == nil && (resolved.Scheme == "http" || resolved.Scheme == "https") {
+					resolved.Fragment = ""
+					links = append(links, PageLink{URL: resolved.String(), Text: nodeText(n)})
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return links
+}
+
+// htmlAttr returns the value of the named attribute, or ""
+func htmlAttr(n *html.Node, name string) string {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// nodeText returns the collapsed text content of a node
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+			sb.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+// isHTMLContent reports whether a response should be parsed as HTML
+func isHTMLContent(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return contentType == "" || strings.Contains(contentType, "html")
+}
+
+// maxExtractedText bounds the plain text stored on each result
+const maxExtractedText = 64 * 1024
+
+// maxHeadings bounds the number of headings stored on each result
+const maxHeadings = 50
+
+// extractPageInfo parses an HTML result and fills in its title, meta
+// description, generator, language, headings and visible text
+func extractPageInfo(result *ScanResult) {
+	if !hasContent(*result) || !isHTMLContent(result.ContentType) {
+		return
+	}
+	doc, err := html.Parse(strings.NewReader(result.Content))
+	if err != nil {
+		return
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "html":
+				result.Language = strings.TrimSpace(htmlAttr(n, "lang"))
+			case "title":
+				if result.Title == "" {
+					result.Title = nodeText(n)
+				}
+			case "meta":
+				content := strings.TrimSpace(htmlAttr(n, "content"))
+				switch strings.ToLower(htmlAttr(n, "name")) {
+				case "description":
+					result.MetaDescription = content
+				case "generator":
+					result.MetaGenerator = content
+				}
+				if strings.EqualFold(htmlAttr(n, "http-equiv"), "content-language") && result.Language == "" {
+					result.Language = content
+				}
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				if text := nodeText(n); text != "" && len(result.Headings) < maxHeadings {
+					result.Headings = append(result.Headings, n.Data+": "+text)
+				}
+			case "script", "style", "noscript", "template":
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	result.Text = extractText(result.Content)
+	if len(result.Text) > maxExtractedText {
+		result.Text = truncateUTF8(result.Text, maxExtractedText)
+	}
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// escapeHTML escapes text taken from scanned pages for the HTML report
+func escapeHTML(s string) string {
+	return html.EscapeString(s)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestExtractPageInfo(t *testing.T) {
+	content := `<!DOCTYPE html>
+<html lang="de">
+<head>
+  <title>  Hidden   Forum </title>
+  <meta name="Description" content=" A place to talk ">
+  <meta name="generator" content="phpBB">
+  <style>body { color: red }</style>
+  <script>var secret = "token";</script>
+</head>
+<body>
+  <h1>Welcome</h1>
+  <p>First <b>post</b>
+     here.</p>
+  <noscript>Enable JavaScript</noscript>
+  <template><h2>Template heading</h2></template>
+  <h3>  Rules </h3>
+  <h2></h2>
+</body>
+</html>`
+	result := ScanResult{Status: "SUCCESS", ContentType: "text/html; charset=utf-8", Content: content}
+	extractPageInfo(&result)
+
+	if result.Title != "Hidden Forum" {
+		t.Errorf("title = %q", result.Title)
+	}
+	if result.MetaDescription != "A place to talk" || result.MetaGenerator != "phpBB" {
+		t.Errorf("meta = %q, %q", result.MetaDescription, result.MetaGenerator)
+	}
+	if result.Language != "de" {
+		t.Errorf("language = %q", result.Language)
+	}
+	if strings.Join(result.Headings, "|") != "h1: Welcome|h3: Rules" {
+		t.Errorf("headings = %q", result.Headings)
+	}
+	if result.Text != "Hidden Forum\nWelcome\nFirst post\nhere.\nRules" {
+		t.Errorf("text = %q", result.Text)
+	}
+	for _, hidden := range []string{"secret", "color", "Enable JavaScript", "Template"} {
+		if strings.Contains(result.Text, hidden) {
+			t.Errorf("text contains %q from a script, style, noscript or template element", hidden)
+		}
+	}
+}
+
+func TestExtractPageInfoContentLanguage(t *testing.T) {
+	result := ScanResult{Status: "SUCCESS", Content: `<html><head><meta http-equiv="Content-Language" content="fr"></head></html>`}
+	extractPageInfo(&result)
+	if result.Language != "fr" {
+		t.Errorf("language = %q, want the Content-Language meta", result.Language)
+	}
+}
+
+func TestExtractPageInfoSkipsNonHTML(t *testing.T) {
+	tests := []ScanResult{
+		{Status: "SUCCESS", ContentType: "application/json", Content: `{"title": "<title>x</title>"}`},
+		{Status: "FAILED", Content: "<title>x</title>"},
+		{Status: "SUCCESS", ContentType: "text/html"},
+	}
+	for _, result := range tests {
+		extractPageInfo(&result)
+		if result.Title != "" || result.Text != "" {
+			t.Errorf("extractPageInfo(%s %q) filled in %q / %q", result.Status, result.ContentType, result.Title, result.Text)
+		}
+	}
+}
+
+func TestExtractPageInfoTruncatesText(t *testing.T) {
+	// Three-byte characters, so the limit falls inside one
+	content := "<p>" + strings.Repeat("€", maxExtractedText) + "</p>"
+	result := ScanResult{Status: "SUCCESS", Content: content}
+	extractPageInfo(&result)
+
+	if len(result.Text) > maxExtractedText || len(result.Text) < maxExtractedText-2 {
+		t.Errorf("text is %d bytes, want just under %d", len(result.Text), maxExtractedText)
+	}
+	if !utf8.ValidString(result.Text) {
+		t.Errorf("truncated text is not valid UTF-8")
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 3, "hel"},
+		{"aé", 2, "a"},
+		{"€€", 4, "€"},
+	}
+	for _, tt := range tests {
+		if got := truncateUTF8(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestExtractLinks(t *testing.T) {
+	content := `<base href="http://abc.onion/forum/">
+<a href="thread?id=1#top">Thread</a>
+<a href="/about">About <b>us</b></a>
+<iframe src="https://example.com/embed"></iframe>
+<a href="mailto:admin@abc.onion">Mail</a>
+<a href="javascript:void(0)">JS</a>`
+	links := extractLinks("http://abc.onion/", content)
+
+	want := []PageLink{
+		{"http://abc.onion/forum/thread?id=1", "Thread"},
+		{"http://abc.onion/about", "About us"},
+		{"https://example.com/embed", ""},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("links = %+v, want %+v", links, want)
+	}
+	for i := range want {
+		if links[i] != want[i] {
+			t.Errorf("link %d = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+}
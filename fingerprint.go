@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+const (
+	// shingleSize is the number of words in each shingle
+	shingleSize = 4
+	// minHashSize is the number of MinHash permutations per page
+	minHashSize = 64
+	// nearDuplicateThreshold is the estimated Jaccard similarity above which
+	// two pages are near-duplicates
+	nearDuplicateThreshold = 0.8
+	// simHashMaxDistance is the largest SimHash Hamming distance between
+	// near-duplicates
+	simHashMaxDistance = 3
+)
+
+// Cluster match kinds, from strongest to weakest
+const (
+	ClusterExact = "exact"
+	ClusterText  = "text"
+	ClusterNear  = "near"
+)
+
+// PageFingerprint identifies a page's content at several levels of fuzziness
+type PageFingerprint struct {
+	// ExactHash is the SHA-256 of the raw response body
+	ExactHash string `json:"exact_hash"`
+	// TextHash is the SHA-256 of the normalized visible text, as used by
+	// change detection; empty when the page has no text
+	TextHash string `json:"text_hash,omitempty"`
+	// SimHash is a 64-bit SimHash over word shingles, in hex
+	SimHash string   `json:"simhash"`
+	MinHash []uint32 `json:"minhash"`
+
+	simHash uint64
+}
+
+// PageCluster is a group of pages with the same or nearly the same content
+type PageCluster struct {
+	ID          int             `json:"id"`
+	Match       string          `json:"match"`
+	Similarity  float64         `json:"similarity"`
+	CrossTarget bool            `json:"cross_target"`
+	Members     []ClusterMember `json:"members"`
+}
+
+// ClusterMember is a page in a cluster
+type ClusterMember struct {
+	URL    string `json:"url"`
+	Name   string `json:"name,omitempty"`
+	Target string `json:"target"`
+}
+
+// minHashSeeds are the per-permutation seeds mixed into the shingle hashes
+var minHashSeeds = func() [minHashSize]uint64 {
+	var seeds [minHashSize]uint64
+	state := uint64(0x9e3779b97f4a7c15)
+	for i := range seeds {
+		state = splitmix64(state)
+		seeds[i] = state
+	}
+	return seeds
+}()
+
+// splitmix64 scrambles a 64-bit value
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// shingles returns the hashes of the overlapping word n-grams of a text
+func shingles(text string) []uint64 {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return nil
+	}
+	n := shingleSize
+	if len(words) < n {
+		n = len(words)
+	}
+
+	seen := make(map[uint64]bool)
+	var hashes []uint64
+	for i := 0; i+n <= len(words); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:i+n], " ")))
+		if sum := h.Sum64(); !seen[sum] {
+			seen[sum] = true
+			hashes = append(hashes, sum)
+		}
+	}
+	return hashes
+}
+
+// fingerprintPage computes the fingerprints of a fetched page, or nil when
+// there is nothing to fingerprint
+func fingerprintPage(result ScanResult) *PageFingerprint {
+	if !hasContent(result) {
+		return nil
+	}
+
+	exact := sha256.Sum256([]byte(result.Content))
+	fp := &PageFingerprint{ExactHash: hex.EncodeToString(exact[:])}
+	// Pages that are only scripts, images or frames have no text to compare
+	text := strings.ToLower(extractText(result.Content))
+	if text != "" {
+		textSum := sha256.Sum256([]byte(text))
+		fp.TextHash = hex.EncodeToString(textSum[:])
+	}
+
+	hashes := shingles(text)
+	if len(hashes) == 0 {
+		return fp
+	}
+
+	var weights [64]int
+	for _, h := range hashes {
+		for bit := 0; bit < 64; bit++ {
+			if h>>bit&1 == 1 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	for bit, weight := range weights {
+		if weight > 0 {
+			fp.simHash |= 1 << bit
+		}
+	}
+	fp.SimHash = fmt.Sprintf("%016x", fp.simHash)
+
+	fp.MinHash = make([]uint32, minHashSize)
+	for i, seed := range minHashSeeds {
+		min := ^uint32(0)
+		for _, h := range hashes {
+			if v := uint32(splitmix64(h ^ seed)); v < min {
+				min = v
+			}
+		}
+		fp.MinHash[i] = min
+	}
+	return fp
+}
+
+// minHashSimilarity estimates the Jaccard similarity of two pages' shingles
+func minHashSimilarity(a, b []uint32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	same := 0
+	for i := range a {
+		if a[i] == b[i] {
+			same++
+		}
+	}
+	return float64(same) / float64(len(a))
+}
+
+// pageSimilarity compares two fingerprints, returning the match kind and
+// similarity, or "" when the pages are not duplicates
+func pageSimilarity(a, b *PageFingerprint) (string, float64) {
+	switch {
+	case a.ExactHash == b.ExactHash:
+		return ClusterExact, 1
+	case a.TextHash != "" && a.TextHash == b.TextHash:
+		return ClusterText, 1
+	}
+	similarity := minHashSimilarity(a.MinHash, b.MinHash)
+	if similarity >= nearDuplicateThreshold ||
+		len(a.MinHash) > 0 && len(b.MinHash) > 0 && bits.OnesCount64(a.simHash^b.simHash) <= simHashMaxDistance {
+		return ClusterNear, similarity
+	}
+	return "", 0
+}
+
+// clusterPages groups the fingerprinted pages of a report into clusters of
+// duplicates and near-duplicates, linking pages transitively
+func clusterPages(results []ScanResult) []PageCluster {
+	var pages []int
+	for i, result := range results {
+		if result.Fingerprint != nil {
+			pages = append(pages, i)
+		}
+	}
+
+	parent := make(map[int]int)
+	var find func(i int) int
+	find = func(i int) int {
+		if p, ok := parent[i]; ok && p != i {
+			parent[i] = find(p)
+			return parent[i]
+		}
+		return i
+	}
+	for x, i := range pages {
+		for _, j := range pages[x+1:] {
+			if kind, _ := pageSimilarity(results[i].Fingerprint, results[j].Fingerprint); kind != "" {
+				if ri, rj := find(i), find(j); ri != rj {
+					parent[rj] = ri
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	var roots []int
+	for _, i := range pages {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			roots = append(roots, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	var clusters []PageCluster
+	for _, root := range roots {
+		members := groups[root]
+		if len(members) < 2 {
+			continue
+		}
+
+		// The cluster is only as strong as its weakest pair
+		cluster := PageCluster{Match: ClusterExact, Similarity: 1}
+		for x, i := range members {
+			for _, j := range members[x+1:] {
+				kind, similarity := pageSimilarity(results[i].Fingerprint, results[j].Fingerprint)
+				if kind == "" {
+					kind, similarity = ClusterNear, minHashSimilarity(results[i].Fingerprint.MinHash, results[j].Fingerprint.MinHash)
+				}
+				if clusterRank(kind) > clusterRank(cluster.Match) {
+					cluster.Match = kind
+				}
+				if similarity < cluster.Similarity {
+					cluster.Similarity = similarity
+				}
+			}
+		}
+
+		targets := make(map[string]bool)
+		for _, i := range members {
+			target := results[i].SeedURL
+			if target == "" {
+				target = resultKey(results[i])
+			}
+			targets[target] = true
+			cluster.Members = append(cluster.Members, ClusterMember{URL: results[i].URL, Name: results[i].Name, Target: target})
+		}
+		cluster.CrossTarget = len(targets) > 1
+		clusters = append(clusters, cluster)
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].CrossTarget && !clusters[j].CrossTarget })
+	for i := range clusters {
+		clusters[i].ID = i + 1
+	}
+	return clusters
+}
+
+// clusterRank orders match kinds from strongest to weakest
+func clusterRank(kind string) int {
+	switch kind {
+	case ClusterExact:
+		return 0
+	case ClusterText:
+		return 1
+	}
+	return 2
+}
+
+// generateClustersSection renders the duplicate clusters for the HTML report
+func generateClustersSection(clusters []PageCluster) string {
+	if len(clusters) == 0 {
+		return ""
+	}
+
+	section := `
+
+            <h2>🧬 Duplicate Clusters</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>Cluster</th>
+                        <th>Match</th>
+                        <th>Similarity</th>
+                        <th>Pages</th>
+                    </tr>
+                </thead>
+                <tbody>`
+
+	for _, cluster := range clusters {
+		match := cluster.Match
+		class := "status-success"
+		if cluster.CrossTarget {
+			match += " (across targets)"
+			class = "status-error"
+		}
+		var pages []string
+		for _, member := range cluster.Members {
+			page := escapeHTML(member.URL)
+			if member.Name != "" {
+				page = "<strong>" + escapeHTML(member.Name) + "</strong> " + page
+			}
+			pages = append(pages, page)
+		}
+		section += fmt.Sprintf(`
+                    <tr>
+                        <td>#%d</td>
+                        <td class="%s">%s</td>
+                        <td>%.0f%%</td>
+                        <td>%s</td>
+                    </tr>`,
+			cluster.ID, class, match, cluster.Similarity*100, strings.Join(pages, "<br>"))
+	}
+
+	section += `
+                </tbody>
+            </table>`
+	return section
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testWords returns n distinct pseudo-random words for a seed
+func testWords(seed uint64, n int) []string {
+	words := make([]string, n)
+	for i := range words {
+		seed = splitmix64(seed)
+		words[i] = fmt.Sprintf("w%x", seed%100000)
+	}
+	return words
+}
+
+func htmlPage(words []string) ScanResult {
+	return ScanResult{
+		Status:  "SUCCESS",
+		Content: "<html><body><p>" + strings.Join(words, " ") + "</p></body></html>",
+	}
+}
+
+func TestShingles(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"one two", 1},
+		{"one two three four", 1},
+		{"one two three four five six", 3},
+		// Repeated shingles are counted once
+		{"a b c d a b c d", 4},
+	}
+	for _, tt := range tests {
+		if got := len(shingles(tt.text)); got != tt.want {
+			t.Errorf("shingles(%q) has %d hashes, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMinHashSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []uint32
+		want float64
+	}{
+		{[]uint32{1, 2, 3, 4}, []uint32{1, 2, 3, 4}, 1},
+		{[]uint32{1, 2, 3, 4}, []uint32{1, 2, 0, 0}, 0.5},
+		{[]uint32{1, 2}, []uint32{1, 2, 3}, 0},
+		{nil, nil, 0},
+	}
+	for _, tt := range tests {
+		if got := minHashSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("minHashSimilarity(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprintPage(t *testing.T) {
+	if fp := fingerprintPage(ScanResult{Status: "FAILED"}); fp != nil {
+		t.Errorf("fingerprintPage of a failed result = %+v, want nil", fp)
+	}
+
+	words := testWords(1, 200)
+	base := fingerprintPage(htmlPage(words))
+	if len(base.SimHash) != 16 || len(base.MinHash) != minHashSize {
+		t.Fatalf("fingerprint = %+v, want a 64-bit SimHash and %d MinHash values", base, minHashSize)
+	}
+
+	// Same text in different markup
+	restyled := htmlPage(words)
+	restyled.Content = "<html><head><style>p{}</style></head><body><div class=\"x\">" + strings.Join(words, " ") + "</div></body></html>"
+	if kind, _ := pageSimilarity(base, fingerprintPage(restyled)); kind != ClusterText {
+		t.Errorf("restyled page matched as %q, want %q", kind, ClusterText)
+	}
+
+	// One word changed
+	edited := append([]string(nil), words...)
+	edited[100] = "changed"
+	kind, similarity := pageSimilarity(base, fingerprintPage(htmlPage(edited)))
+	if kind != ClusterNear || similarity < nearDuplicateThreshold {
+		t.Errorf("edited page matched as %q at %.2f, want %q", kind, similarity, ClusterNear)
+	}
+
+	if kind, _ := pageSimilarity(base, fingerprintPage(htmlPage(testWords(2, 200)))); kind != "" {
+		t.Errorf("unrelated page matched as %q, want no match", kind)
+	}
+}
+
+func TestClusterPages(t *testing.T) {
+	words := testWords(1, 200)
+	edited := append([]string(nil), words...)
+	edited[50] = "changed"
+	pages := []ScanResult{
+		htmlPage(words),
+		htmlPage(words),
+		htmlPage(edited),
+		htmlPage(testWords(2, 200)),
+	}
+	for i := range pages {
+		pages[i].URL = fmt.Sprintf("http://site%d.onion/", i)
+		pages[i].Fingerprint = fingerprintPage(pages[i])
+	}
+
+	clusters := clusterPages(pages)
+	if len(clusters) != 1 {
+		t.Fatalf("got %d clusters, want 1", len(clusters))
+	}
+	cluster := clusters[0]
+	if len(cluster.Members) != 3 || cluster.Match != ClusterNear || !cluster.CrossTarget {
+		t.Errorf("cluster = %+v, want 3 near-duplicate members across targets", cluster)
+	}
+}
+
+func TestClusterPagesIgnoresPagesWithoutText(t *testing.T) {
+	page := func(url, content string) ScanResult {
+		result := ScanResult{URL: url, Status: "SUCCESS", StatusCode: 200, ContentType: "text/html", Content: content}
+		result.Fingerprint = fingerprintPage(result)
+		return result
+	}
+	results := []ScanResult{
+		page("http://a.onion/", `<html><body><script src="/app.js"></script><img src="/logo.png"></body></html>`),
+		page("http://b.onion/", `<html><head><script>window.location = "/shop";</script></head><body><iframe src="/frame"></iframe></body></html>`),
+	}
+	for _, result := range results {
+		if result.Fingerprint == nil || result.Fingerprint.TextHash != "" {
+			t.Fatalf("fingerprint of %s = %+v, want one without a text hash", result.URL, result.Fingerprint)
+		}
+	}
+	if kind, _ := pageSimilarity(results[0].Fingerprint, results[1].Fingerprint); kind != "" {
+		t.Errorf("pageSimilarity() = %q, want unrelated script-only pages not to match", kind)
+	}
+	if clusters := clusterPages(results); len(clusters) != 0 {
+		t.Errorf("clusterPages() = %+v, want no clusters", clusters)
+	}
+
+	// Identical script-only pages are still exact duplicates
+	results = append(results, page("http://c.onion/", results[0].Content))
+	clusters := clusterPages(results)
+	if len(clusters) != 1 || clusters[0].Match != ClusterExact || len(clusters[0].Members) != 2 {
+		t.Errorf("clusterPages() = %+v, want one exact cluster of a.onion and c.onion", clusters)
+	}
+}
@@ -3,6 +3,13 @@ module tor-scraper
 go 1.21
 
 require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/klauspost/compress v1.17.4
+	github.com/santhosh-tekuri/jsonschema/v5 v5.3.1
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/crypto v0.16.0
 	golang.org/x/net v0.19.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require golang.org/x/sys v0.15.0 // indirect
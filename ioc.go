@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// IOC types
+const (
+	IOCBitcoin        = "bitcoin"
+	IOCMonero         = "monero"
+	IOCEthereum       = "ethereum"
+	IOCEmail          = "email"
+	IOCPGPKey         = "pgp_key"
+	IOCPGPFingerprint = "pgp_fingerprint"
+	IOCTelegram       = "telegram"
+	IOCJabber         = "jabber"
+	IOCTox            = "tox"
+	IOCDomain         = "domain"
+	IOCIPv4           = "ipv4"
+	IOCIPv6           = "ipv6"
+	IOCMD5            = "md5"
+	IOCSHA1           = "sha1"
+	IOCSHA256         = "sha256"
+)
+
+// IOC is an indicator of compromise found on a page
+type IOC struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ReportIOC is an indicator deduplicated across all pages of a run
+type ReportIOC struct {
+	Type  string   `json:"type"`
+	Value string   `json:"value"`
+	Pages int      `json:"pages"`
+	URLs  []string `json:"urls"`
+}
+
+var (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	bech32Alphabet = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	btcBase58Pattern   = regexp.MustCompile(`\b[13][1-9A-HJ-NP-Za-km-z]{25,34}\b`)
+	btcBech32Pattern   = regexp.MustCompile(`(?i)\bbc1[02-9ac-hj-np-z]{8,87}\b`)
+	moneroPattern      = regexp.MustCompile(`\b[48][1-9A-HJ-NP-Za-km-z]{94}(?:[1-9A-HJ-NP-Za-km-z]{11})?\b`)
+	ethereumPattern    = regexp.MustCompile(`\b0x[0-9a-fA-F]{40}\b`)
+	emailPattern       = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@(?:[a-z0-9-]+\.)+[a-z]{2,24}\b`)
+	pgpKeyPattern      = regexp.MustCompile(`-----BEGIN PGP PUBLIC KEY BLOCK-----[\s\S]*?-----END PGP PUBLIC KEY BLOCK-----`)
+	pgpFingerprintExpr = regexp.MustCompile(`\b(?:[0-9A-Fa-f]{4} {1,2}){9}[0-9A-Fa-f]{4}\b`)
+	telegramPattern    = regexp.MustCompile(`(?i)(?:\b(?:t\.me|telegram\.me)/|\btelegram\W{1,3}@)([a-z0-9_]{5,32})\b`)
+	jabberPattern      = regexp.MustCompile(`(?i)(?:\bxmpp:|\b(?:jabber|xmpp)\W{1,3})([a-z0-9._%+-]+@(?:[a-z0-9-]+\.)+[a-z]{2,24})\b`)
+	toxPattern         = regexp.MustCompile(`\b[0-9A-Fa-f]{76}\b`)
+	domainPattern      = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,24}\b`)
+	ipv4Pattern        = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern        = regexp.MustCompile(`(?i)[0-9a-f:]*:[0-9a-f:]*:[0-9a-f:.]*`)
+	hashPattern        = regexp.MustCompile(`\b(?:[0-9A-Fa-f]{64}|[0-9A-Fa-f]{40}|[0-9A-Fa-f]{32})\b`)
+)
+
+// fileExtensions are suffixes that look like TLDs but are usually file names
+var fileExtensions = map[string]bool{
+	"asp": true, "aspx": true, "bak": true, "cgi": true, "css": true, "doc": true,
+	"docx": true, "exe": true, "gif": true, "gz": true, "htm": true, "html": true,
+	"ico": true, "jpeg": true, "jpg": true, "js": true, "json": true, "jsp": true,
+	"log": true, "md": true, "mp3": true, "mp4": true, "pdf": true, "php": true,
+	"png": true, "rar": true, "sh": true, "svg": true, "tar": true, "txt": true,
+	"webp": true, "xml": true, "zip": true,
+}
+
+// extractIOCs returns the indicators found in a result, deduplicated. HTML
+// pages are searched through their visible text and link URLs so markup and
+// scripts do not produce noise.
+func extractIOCs(result ScanResult) []IOC {
+	if !hasContent(result) {
+		return nil
+	}
+	text := result.Content
+	if isHTMLContent(result.ContentType) {
+		var sb strings.Builder
+		sb.WriteString(extractText(result.Content))
+		for _, link := range extractLinks(servedURL(result), result.Content) {
+			sb.WriteString("\n" + link.URL)
+		}
+		text = sb.String()
+	}
+
+	var iocs []IOC
+	seen := make(map[IOC]bool)
+	add := func(iocType, value string) {
+		ioc := IOC{Type: iocType, Value: value}
+		if !seen[ioc] {
+			seen[ioc] = true
+			iocs = append(iocs, ioc)
+		}
+	}
+
+	for _, match := range btcBase58Pattern.FindAllString(text, -1) {
+		if validBase58Check(match) {
+			add(IOCBitcoin, match)
+		}
+	}
+	for _, match := range btcBech32Pattern.FindAllString(text, -1) {
+		if validBech32Address(match) {
+			add(IOCBitcoin, strings.ToLower(match))
+		}
+	}
+	for _, match := range moneroPattern.FindAllString(text, -1) {
+		if validMoneroAddress(match) {
+			add(IOCMonero, match)
+		}
+	}
+	for _, match := range ethereumPattern.FindAllString(text, -1) {
+		if validEthereumAddress(match) {
+			add(IOCEthereum, strings.ToLower(match))
+		}
+	}
+
+	jabber := make(map[string]bool)
+	for _, match := range jabberPattern.FindAllStringSubmatch(text, -1) {
+		value := strings.ToLower(match[1])
+		jabber[value] = true
+		add(IOCJabber, value)
+	}
+	for _, match := range emailPattern.FindAllString(text, -1) {
+		value := strings.ToLower(match)
+		if !jabber[value] && !fileExtensions[value[strings.LastIndex(value, ".")+1:]] {
+			add(IOCEmail, value)
+		}
+	}
+	for _, match := range telegramPattern.FindAllStringSubmatch(text, -1) {
+		add(IOCTelegram, "@"+strings.ToLower(match[1]))
+	}
+	for _, match := range toxPattern.FindAllString(text, -1) {
+		if validToxID(match) {
+			add(IOCTox, strings.ToUpper(match))
+		}
+	}
+
+	for _, match := range pgpKeyPattern.FindAllString(text, -1) {
+		add(IOCPGPKey, match)
+	}
+	for _, match := range pgpFingerprintExpr.FindAllString(text, -1) {
+		add(IOCPGPFingerprint, strings.ToUpper(strings.Join(strings.Fields(match), "")))
+	}
+
+	for _, match := range domainPattern.FindAllString(text, -1) {
+		value := strings.ToLower(match)
+		tld := value[strings.LastIndex(value, ".")+1:]
+		if tld != "onion" && !fileExtensions[tld] {
+			add(IOCDomain, value)
+		}
+	}
+	for _, match := range ipv4Pattern.FindAllString(text, -1) {
+		if ip := net.ParseIP(match); ip != nil && !ip.IsUnspecified() {
+			add(IOCIPv4, match)
+		}
+	}
+	for _, match := range ipv6Pattern.FindAllString(text, -1) {
+		if validIPv6(match) {
+			add(IOCIPv6, net.ParseIP(match).String())
+		}
+	}
+
+	for _, match := range hashPattern.FindAllString(text, -1) {
+		switch len(match) {
+		case 32:
+			add(IOCMD5, strings.ToLower(match))
+		case 40:
+			add(IOCSHA1, strings.ToLower(match))
+		case 64:
+			add(IOCSHA256, strings.ToLower(match))
+		}
+	}
+
+	return iocs
+}
+
+// decodeBase58 decodes a Bitcoin-style base58 string, keeping leading zeros
+func decodeBase58(s string) ([]byte, bool) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		digit := strings.IndexRune(base58Alphabet, c)
+		if digit < 0 {
+			return nil, false
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	zeros := 0
+	for zeros < len(s) && s[zeros] == '1' {
+		zeros++
+	}
+	return append(make([]byte, zeros), n.Bytes()...), true
+}
+
+// validBase58Check reports whether s is a mainnet P2PKH or P2SH address with
+// a valid double SHA-256 checksum
+func validBase58Check(s string) bool {
+	raw, ok := decodeBase58(s)
+	if !ok || len(raw) != 25 || (raw[0] != 0x00 && raw[0] != 0x05) {
+		return false
+	}
+	first := sha256.Sum256(raw[:21])
+	second := sha256.Sum256(first[:])
+	return bytes.Equal(second[:4], raw[21:])
+}
+
+// bech32Polymod computes the BIP-173 checksum over the expanded HRP and data
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// validBech32Address reports whether s is a mainnet segwit address with a
+// valid bech32 (version 0) or bech32m (version 1+) checksum
+func validBech32Address(s string) bool {
+	if s != strings.ToLower(s) && s != strings.ToUpper(s) {
+		return false
+	}
+	s = strings.ToLower(s)
+	data := make([]byte, 0, len(s)-3)
+	for _, c := range s[3:] {
+		data = append(data, byte(strings.IndexRune(bech32Alphabet, c)))
+	}
+	if len(data) < 7 {
+		return false
+	}
+
+	// HRP "bc" expanded: high bits, separator, low bits
+	values := append([]byte{3, 3, 0, 2, 3}, data...)
+	constant := bech32Polymod(values)
+	version := data[0]
+	if version > 16 || (version == 0 && constant != 1) || (version > 0 && constant != 0x2bc830a3) {
+		return false
+	}
+
+	programLen := (len(data) - 7) * 5 / 8
+	if version == 0 {
+		return programLen == 20 || programLen == 32
+	}
+	return programLen >= 2 && programLen <= 40
+}
+
+// moneroBlockSizes maps the length of an encoded Monero base58 block to its
+// decoded size; -1 marks invalid lengths
+var moneroBlockSizes = []int{0, -1, 1, 2, -1, 3, 4, 5, -1, 6, 7, 8}
+
+// validMoneroAddress reports whether s is a Monero address whose Keccak-256
+// checksum matches. Monero base58 encodes 8-byte blocks as 11 characters.
+func validMoneroAddress(s string) bool {
+	var raw []byte
+	for start := 0; start < len(s); start += 11 {
+		end := start + 11
+		if end > len(s) {
+			end = len(s)
+		}
+		size := moneroBlockSizes[end-start]
+		if size < 0 {
+			return false
+		}
+		n := new(big.Int)
+		for _, c := range s[start:end] {
+			n.Mul(n, big.NewInt(58))
+			n.Add(n, big.NewInt(int64(strings.IndexRune(base58Alphabet, c))))
+		}
+		if n.BitLen() > size*8 {
+			return false
+		}
+		raw = append(raw, n.FillBytes(make([]byte, size))...)
+	}
+	if len(raw) < 5 {
+		return false
+	}
+
+	h := sha3.NewLegacyKeccak256()
+	h.Write(raw[:len(raw)-4])
+	return bytes.Equal(h.Sum(nil)[:4], raw[len(raw)-4:])
+}
+
+// validEthereumAddress checks the EIP-55 mixed-case checksum; all-lowercase
+// and all-uppercase addresses carry none and are accepted
+func validEthereumAddress(s string) bool {
+	addr := s[2:]
+	lower := strings.ToLower(addr)
+	if addr == lower || addr == strings.ToUpper(addr) {
+		return true
+	}
+
+	h := sha3.NewLegacyKeccak256()
+	h.Write([]byte(lower))
+	hash := hex.EncodeToString(h.Sum(nil))
+	for i, c := range addr {
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' || c >= 'A' && c <= 'F' && hash[i] < '8' {
+			return false
+		}
+	}
+	return true
+}
+
+// validToxID checks a Tox ID: public key, nospam and a 2-byte XOR checksum
+func validToxID(s string) bool {
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != 38 {
+		return false
+	}
+	var checksum [2]byte
+	for i, b := range raw[:36] {
+		checksum[i%2] ^= b
+	}
+	return checksum[0] == raw[36] && checksum[1] == raw[37]
+}
+
+// validIPv6 reports whether s is a specific IPv6 address with at least three
+// groups, which rules out things like "a::" in CSS selectors
+func validIPv6(s string) bool {
+	ip := net.ParseIP(s)
+	if ip == nil || ip.To4() != nil || ip.IsUnspecified() {
+		return false
+	}
+	groups := 0
+	for _, group := range strings.Split(s, ":") {
+		if group != "" {
+			groups++
+		}
+	}
+	return groups >= 3
+}
+
+// collectIOCs deduplicates the indicators of every result across the run,
+// listing the pages each was seen on
+func collectIOCs(results []ScanResult) []ReportIOC {
+	index := make(map[IOC]int)
+	var collected []ReportIOC
+	for _, result := range results {
+		for _, ioc := range result.IOCs {
+			i, ok := index[ioc]
+			if !ok {
+				i = len(collected)
+				index[ioc] = i
+				collected = append(collected, ReportIOC{Type: ioc.Type, Value: ioc.Value})
+			}
+			collected[i].Pages++
+			collected[i].URLs = append(collected[i].URLs, resultKey(result))
+		}
+	}
+	sort.SliceStable(collected, func(i, j int) bool { return collected[i].Type < collected[j].Type })
+	return collected
+}
+
+// writeIOCs saves the run's indicators as iocs.json and iocs.csv, removing
+// stale files when there are none
+func writeIOCs(iocs []ReportIOC, outputDir string) error {
+	jsonPath := filepath.Join(outputDir, "iocs.json")
+	csvPath := filepath.Join(outputDir, "iocs.csv")
+	if len(iocs) == 0 {
+		for _, path := range []string{jsonPath, csvPath} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove stale IOC file: %w", err)
+			}
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(iocs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal IOCs: %w", err)
+	}
+	if err := os.WriteFile(jsonPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write IOC JSON: %w", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Type,Value,Pages,URLs\n")
+	for _, ioc := range iocs {
+		sb.WriteString(fmt.Sprintf("%s,%s,%d,%s\n",
+			ioc.Type, csvQuote(ioc.Value), ioc.Pages, csvQuote(strings.Join(ioc.URLs, " "))))
+	}
+	if err := os.WriteFile(csvPath, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write IOC CSV: %w", err)
+	}
+	return nil
+}
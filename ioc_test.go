@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestValidBase58Check(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", true},
+		{"3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy", true},
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb", false}, // checksum
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7Divf", false},   // length
+		{"mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", false}, // testnet version
+		{"1A1zP1eP5QGefi2DMPTfTL5SLmv7Divf0a", false}, // not base58
+	}
+	for _, tt := range tests {
+		if got := validBase58Check(tt.addr); got != tt.want {
+			t.Errorf("validBase58Check(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestValidBech32Address(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq", true},
+		{"BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", true},
+		{"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0", true},
+		{"bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdr", false}, // checksum
+		{"bc1Qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq", false}, // mixed case
+		{"bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mbq", false}, // 'b' is not bech32
+		{"bc1qqqqqqq", false}, // too short
+	}
+	for _, tt := range tests {
+		if got := validBech32Address(tt.addr); got != tt.want {
+			t.Errorf("validBech32Address(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestValidEthereumAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		// EIP-55 test vectors
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", true},
+		{"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", true},
+		{"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB", true},
+		{"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb", true},
+		// No checksum
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", true},
+		{"0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", true},
+		// One letter with the wrong case
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", false},
+		{"0x5AAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", false},
+	}
+	for _, tt := range tests {
+		if got := validEthereumAddress(tt.addr); got != tt.want {
+			t.Errorf("validEthereumAddress(%q) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestValidToxID(t *testing.T) {
+	raw := make([]byte, 38)
+	for i := 0; i < 36; i++ {
+		raw[i] = byte(i * 7)
+		raw[36+i%2] ^= raw[i]
+	}
+	id := strings.ToUpper(hex.EncodeToString(raw))
+	if !validToxID(id) {
+		t.Errorf("validToxID(%q) = false, want true", id)
+	}
+	raw[37] ^= 1
+	if bad := hex.EncodeToString(raw); validToxID(bad) {
+		t.Errorf("validToxID(%q) = true, want false", bad)
+	}
+}
+
+func TestValidIPv6(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"2001:db8::1", true},
+		{"fe80:0:0:0:1:2:3:4", true},
+		{"a::", false},
+		{"::", false},
+		{"::ffff:1.2.3.4", false},
+		{"12:34", false},
+	}
+	for _, tt := range tests {
+		if got := validIPv6(tt.s); got != tt.want {
+			t.Errorf("validIPv6(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestExtractIOCs(t *testing.T) {
+	result := ScanResult{
+		URL:         "http://abc.onion/",
+		Status:      "SUCCESS",
+		ContentType: "text/plain",
+		Content: "Donate: 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa or 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb\n" +
+			"ETH 0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed\n" +
+			"Contact admin@example.com, jabber: ops@xmpp.example.org, t.me/example_channel\n" +
+			"Mirror at mirror.example.net, not logo.png\n",
+	}
+	got := make(map[IOC]bool)
+	for _, ioc := range extractIOCs(result) {
+		got[ioc] = true
+	}
+	want := []IOC{
+		{IOCBitcoin, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa"},
+		{IOCEthereum, "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"},
+		{IOCEmail, "admin@example.com"},
+		{IOCJabber, "ops@xmpp.example.org"},
+		{IOCTelegram, "@example_channel"},
+		{IOCDomain, "mirror.example.net"},
+	}
+	for _, ioc := range want {
+		if !got[ioc] {
+			t.Errorf("missing %+v", ioc)
+		}
+	}
+	for _, ioc := range []IOC{
+		{IOCBitcoin, "1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNb"},
+		{IOCEmail, "ops@xmpp.example.org"},
+		{IOCDomain, "logo.png"},
+	} {
+		if got[ioc] {
+			t.Errorf("unexpected %+v", ioc)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxLeakBody bounds the bytes read from each probed path
+const maxLeakBody = 512 * 1024
+
+// Leak finding kinds
+const (
+	LeakPath         = "leak_path"
+	LeakPublicIP     = "public_ip"
+	LeakClearnetHost = "clearnet_host"
+	LeakInternalHost = "internal_host"
+	LeakEmail        = "email"
+)
+
+// LeakFinding is a detail that may reveal where a hidden service really runs
+type LeakFinding struct {
+	Kind     string `json:"kind"`
+	Severity string `json:"severity"`
+	Value    string `json:"value"`
+	// Location is where the value was found, e.g. "header Server" or "body /server-status"
+	Location string `json:"location"`
+}
+
+// leakProbe is a well-known path that exposes server internals, with a
+// check that the response really is that page and not a soft 404
+type leakProbe struct {
+	path     string
+	severity string
+	marker   *regexp.Regexp
+}
+
+// leakProbes are the paths requested on every onion host
+var leakProbes = []leakProbe{
+	{"/server-status", "critical", regexp.MustCompile(`Apache Server Status`)},
+	{"/server-info", "high", regexp.MustCompile(`Apache Server Information`)},
+	{"/phpinfo.php", "high", regexp.MustCompile(`<title>phpinfo\(\)</title>|PHP Version [\d.]+`)},
+	{"/info.php", "high", regexp.MustCompile(`<title>phpinfo\(\)</title>|PHP Version [\d.]+`)},
+	{"/.git/HEAD", "high", regexp.MustCompile(`^(?:ref: refs/|[0-9a-f]{40}\s*$)`)},
+	{"/nginx_status", "medium", regexp.MustCompile(`Active connections:`)},
+	{"/status", "medium", regexp.MustCompile(`Active connections:|Apache Server Status`)},
+}
+
+// internalHostPattern matches hostnames under private-use and LAN suffixes
+var internalHostPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+(?:local|localdomain|internal|intranet|lan|corp|home|private)\b`)
+
+// reservedNetworks are special-purpose ranges that are never globally
+// routable unicast: "this network", shared CGNAT space, documentation and
+// benchmarking ranges, and 240.0.0.0/4, which also holds netmasks such as
+// 255.255.255.0 and the broadcast address
+var reservedNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "192.0.2.0/24",
+		"198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24", "240.0.0.0/4",
+		"100::/64", "2001:2::/48", "2001:db8::/32", "3fff::/20",
+	} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// isPublicIP reports whether ip is a globally routable unicast address
+func isPublicIP(ip net.IP) bool {
+	if ip == nil || ip.IsUnspecified() || ip.IsLoopback() || ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// scanForLeaks looks for public IPs, clearnet and internal hostnames and
+// email addresses in text. Clearnet hostnames are only reported when
+// withHosts is set, since ordinary page bodies link to clearnet sites.
+func scanForLeaks(text, location, ipSeverity string, withHosts bool) []LeakFinding {
+	var findings []LeakFinding
+	for _, match := range ipv4Pattern.FindAllString(text, -1) {
+		if isPublicIP(net.ParseIP(match)) {
+			findings = append(findings, LeakFinding{Kind: LeakPublicIP, Severity: ipSeverity, Value: match, Location: location})
+		}
+	}
+	for _, match := range ipv6Pattern.FindAllString(text, -1) {
+		if validIPv6(match) && isPublicIP(net.ParseIP(match)) {
+			findings = append(findings, LeakFinding{Kind: LeakPublicIP, Severity: ipSeverity, Value: net.ParseIP(match).String(), Location: location})
+		}
+	}
+
+	internal := make(map[string]bool)
+	for _, match := range internalHostPattern.FindAllString(text, -1) {
+		value := strings.ToLower(match)
+		internal[value] = true
+		findings = append(findings, LeakFinding{Kind: LeakInternalHost, Severity: "medium", Value: value, Location: location})
+	}
+	if withHosts {
+		for _, match := range domainPattern.FindAllString(text, -1) {
+			value := strings.ToLower(match)
+			tld := value[strings.LastIndex(value, ".")+1:]
+			if tld != "onion" && !fileExtensions[tld] && !internal[value] {
+				findings = append(findings, LeakFinding{Kind: LeakClearnetHost, Severity: "high", Value: value, Location: location})
+			}
+		}
+	}
+
+	for _, match := range emailPattern.FindAllString(text, -1) {
+		value := strings.ToLower(match)
+		if !fileExtensions[value[strings.LastIndex(value, ".")+1:]] {
+			findings = append(findings, LeakFinding{Kind: LeakEmail, Severity: "low", Value: value, Location: location})
+		}
+	}
+	return findings
+}
+
+// originHeaders are response headers whose hostnames name the servers behind
+// the service, such as redirects, proxies and alternative endpoints
+var originHeaders = map[string]bool{
+	"Location":         true,
+	"Content-Location": true,
+	"Refresh":          true,
+	"Alt-Svc":          true,
+	"Via":              true,
+	"Forwarded":        true,
+	"X-Backend-Server": true,
+	"X-Served-By":      true,
+	"X-Server":         true,
+	"X-Host":           true,
+	"X-Real-Ip":        true,
+}
+
+// cookieDomainPattern matches the Domain attribute of a Set-Cookie header
+var cookieDomainPattern = regexp.MustCompile(`(?i);\s*domain\s*=\s*([^;\s]+)`)
+
+// scanHeadersForLeaks checks every response header for IPs, internal hosts
+// and emails. Clearnet hostnames are only reported from headers that reveal
+// origin infrastructure and from Set-Cookie Domain attributes, since others
+// such as Content-Security-Policy routinely name CDNs and font hosts.
+func scanHeadersForLeaks(headers http.Header) []LeakFinding {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var findings []LeakFinding
+	for _, name := range names {
+		value := strings.Join(headers[name], "\n")
+		withHosts := originHeaders[name] || strings.HasPrefix(name, "X-Forwarded-")
+		findings = append(findings, scanForLeaks(value, "header "+name, "critical", withHosts)...)
+		if name == "Set-Cookie" {
+			var domains []string
+			for _, match := range cookieDomainPattern.FindAllStringSubmatch(value, -1) {
+				domains = append(domains, strings.TrimPrefix(match[1], "."))
+			}
+			for _, finding := range scanForLeaks(strings.Join(domains, "\n"), "header Set-Cookie", "critical", true) {
+				if finding.Kind == LeakClearnetHost {
+					findings = append(findings, finding)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// checkLeaks probes an onion result's host for leak paths and scans its
+// response and the probed pages for identifying details
+func checkLeaks(client *http.Client, result *ScanResult) {
+	base, err := url.Parse(resultKey(*result))
+	if err != nil {
+		return
+	}
+	if _, ok := onionServiceHost(base.Hostname()); !ok {
+		return
+	}
+
+	var findings []LeakFinding
+	findings = append(findings, scanHeadersForLeaks(result.Headers)...)
+	if hasContent(*result) {
+		findings = append(findings, scanForLeaks(result.Content, "body "+base.EscapedPath(), "high", false)...)
+	}
+
+	for _, probe := range leakProbes {
+		probeURL := base.ResolveReference(&url.URL{Path: probe.path}).String()
+		resp, body, err := fetchURL(client, probeURL, maxLeakBody)
+		if err != nil || resp.StatusCode != http.StatusOK || !probe.marker.Match(body) {
+			continue
+		}
+		fmt.Printf("[ALERT] Exposed %s on %s\n", probe.path, base.Host)
+		findings = append(findings, LeakFinding{Kind: LeakPath, Severity: probe.severity, Value: probeURL, Location: probe.path})
+		findings = append(findings, scanHeadersForLeaks(resp.Header)...)
+		findings = append(findings, scanForLeaks(string(body), "body "+probe.path, "critical", true)...)
+	}
+
+	seen := make(map[LeakFinding]bool)
+	for _, finding := range findings {
+		if !seen[finding] {
+			seen[finding] = true
+			result.Leaks = append(result.Leaks, finding)
+		}
+	}
+}
+
+// runLeakChecks runs the leak checks on every onion seed page of the report
+func runLeakChecks(client *http.Client, report *ScanReport) {
+	findings := 0
+	for i := range report.Results {
+		result := &report.Results[i]
+		if result.Status != "SUCCESS" || result.Depth > 0 {
+			continue
+		}
+		checkLeaks(client, result)
+		findings += len(result.Leaks)
+	}
+	fmt.Printf("[INFO] Leak checks found %d possible deanonymization leaks\n", findings)
+}
+
+// generateLeaksSection renders the leak findings for the HTML report
+func generateLeaksSection(report ScanReport) string {
+	section := ""
+	for _, result := range report.Results {
+		for _, leak := range result.Leaks {
+			section += fmt.Sprintf(`
+                    <tr>
+                        <td><strong>%s</strong></td>
+                        <td class="%s">%s</td>
+                        <td>%s</td>
+                        <td>%s</td>
+                        <td>%s</td>
+                    </tr>`,
+				escapeHTML(result.URL), severityClass(leak.Severity), strings.ToUpper(leak.Severity),
+				leak.Kind, escapeHTML(leak.Value), escapeHTML(leak.Location))
+		}
+	}
+	if section == "" {
+		return ""
+	}
+
+	return `
+
+            <h2>🕳️ Deanonymization Leaks</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>URL</th>
+                        <th>Severity</th>
+                        <th>Kind</th>
+                        <th>Value</th>
+                        <th>Location</th>
+                    </tr>
+                </thead>
+                <tbody>` + section + `
+                </tbody>
+            </table>`
+}
+
+// writeLeaksText renders the leak findings for the TXT report
+func writeLeaksText(report ScanReport) string {
+	var sb strings.Builder
+	for _, result := range report.Results {
+		for _, leak := range result.Leaks {
+			sb.WriteString(fmt.Sprintf("[%s] %s\n    %s: %s (%s)\n\n",
+				strings.ToUpper(leak.Severity), result.URL, leak.Kind, leak.Value, leak.Location))
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "🕳️ DEANONYMIZATION LEAKS\n═══════════════════════════════════════════════════════════════════════════\n\n" + sb.String()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"185.220.101.1", true},
+		{"2606:4700::1111", true},
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"10.1.2.3", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"127.0.0.1", false},
+		{"169.254.1.1", false},
+		{"172.16.0.1", false},
+		{"192.0.0.8", false},
+		{"192.0.2.10", false},
+		{"192.168.1.1", false},
+		{"198.18.0.1", false},
+		{"198.51.100.7", false},
+		{"203.0.113.9", false},
+		{"224.0.0.251", false},
+		{"240.0.0.1", false},
+		{"255.255.255.0", false},
+		{"255.255.255.255", false},
+		{"::1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"ff02::1", false},
+		{"2001:db8::1", false},
+		{"100::1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+	if isPublicIP(nil) {
+		t.Errorf("isPublicIP(nil) = true, want false")
+	}
+}
+
+func TestScanForLeaks(t *testing.T) {
+	text := `SERVER_ADDR 185.220.101.1 netmask 255.255.255.0 gateway 192.168.1.1
+broadcast 255.255.255.255 docs 192.0.2.10 cgnat 100.64.3.4 v6 2606:4700::1111
+host db.internal mirror mirror.example.net contact admin@example.com`
+
+	tests := []struct {
+		withHosts bool
+		want      []LeakFinding
+	}{
+		{false, []LeakFinding{
+			{Kind: LeakPublicIP, Severity: "critical", Value: "185.220.101.1", Location: "body /phpinfo.php"},
+			{Kind: LeakPublicIP, Severity: "critical", Value: "2606:4700::1111", Location: "body /phpinfo.php"},
+			{Kind: LeakInternalHost, Severity: "medium", Value: "db.internal", Location: "body /phpinfo.php"},
+			{Kind: LeakEmail, Severity: "low", Value: "admin@example.com", Location: "body /phpinfo.php"},
+		}},
+		{true, []LeakFinding{
+			{Kind: LeakPublicIP, Severity: "critical", Value: "185.220.101.1", Location: "body /phpinfo.php"},
+			{Kind: LeakPublicIP, Severity: "critical", Value: "2606:4700::1111", Location: "body /phpinfo.php"},
+			{Kind: LeakInternalHost, Severity: "medium", Value: "db.internal", Location: "body /phpinfo.php"},
+			{Kind: LeakClearnetHost, Severity: "high", Value: "mirror.example.net", Location: "body /phpinfo.php"},
+			// The email's domain is a clearnet host too
+			{Kind: LeakClearnetHost, Severity: "high", Value: "example.com", Location: "body /phpinfo.php"},
+			{Kind: LeakEmail, Severity: "low", Value: "admin@example.com", Location: "body /phpinfo.php"},
+		}},
+	}
+	for _, tt := range tests {
+		got := scanForLeaks(text, "body /phpinfo.php", "critical", tt.withHosts)
+		if len(got) != len(tt.want) {
+			t.Errorf("withHosts=%v: got %d findings %+v, want %d", tt.withHosts, len(got), got, len(tt.want))
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("withHosts=%v: finding %d = %+v, want %+v", tt.withHosts, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestScanHeadersForLeaks(t *testing.T) {
+	headers := http.Header{
+		"Content-Security-Policy": {"default-src 'self' fonts.gstatic.com; report-uri https://csp.example.org/report"},
+		"Link":                    {"<https://cdn.example.net/app.css>; rel=preload"},
+		"Location":                {"https://origin.example.com/login"},
+		"X-Forwarded-Host":        {"backend.example.com"},
+		"Set-Cookie":              {"sid=1; Path=/; Domain=.shop.example.com; HttpOnly"},
+		"X-Origin":                {"203.0.113.9, 185.220.101.1"},
+	}
+	want := map[LeakFinding]bool{
+		{Kind: LeakClearnetHost, Severity: "high", Value: "origin.example.com", Location: "header Location"}:          true,
+		{Kind: LeakClearnetHost, Severity: "high", Value: "shop.example.com", Location: "header Set-Cookie"}:          true,
+		{Kind: LeakClearnetHost, Severity: "high", Value: "backend.example.com", Location: "header X-Forwarded-Host"}: true,
+		{Kind: LeakPublicIP, Severity: "critical", Value: "185.220.101.1", Location: "header X-Origin"}:               true,
+	}
+
+	got := scanHeadersForLeaks(headers)
+	if len(got) != len(want) {
+		t.Errorf("got %d findings %+v, want %d", len(got), got, len(want))
+	}
+	for _, finding := range got {
+		if !want[finding] {
+			t.Errorf("unexpected finding %+v", finding)
+		}
+	}
+}
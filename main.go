@@ -3,7 +3,10 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net"
@@ -19,39 +22,169 @@ import (
 
 // ScanResult represents the result of scanning a single URL
 type ScanResult struct {
-	URL        string    `json:"url"`
-	Status     string    `json:"status"`
-	StatusCode int       `json:"status_code"`
-	Error      string    `json:"error,omitempty"`
-	Timestamp  time.Time `json:"timestamp"`
-	Content    string    `json:"content,omitempty"`
+	URL          string      `json:"url"`
+	CanonicalURL string      `json:"canonical_url,omitempty"`
+	FinalURL     string      `json:"final_url,omitempty"`
+	Name         string      `json:"name,omitempty"`
+	Type         string      `json:"type,omitempty"`
+	Status       string      `json:"status"`
+	StatusCode   int         `json:"status_code"`
+	Error        string      `json:"error,omitempty"`
+	Timestamp    time.Time   `json:"timestamp"`
+	LatencyMS    int64       `json:"latency_ms"`
+	ContentType  string      `json:"content_type,omitempty"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Content      string      `json:"content,omitempty"`
+
+	// Page details extracted from HTML content
+	Title           string   `json:"title,omitempty"`
+	MetaDescription string   `json:"meta_description,omitempty"`
+	MetaGenerator   string   `json:"meta_generator,omitempty"`
+	Language        string   `json:"language,omitempty"`
+	Headings        []string `json:"headings,omitempty"`
+	Text            string   `json:"text,omitempty"`
+
+	// Matches are the watchlist hits on the content and extracted text
+	Matches []WatchlistMatch `json:"matches,omitempty"`
+	// IOCs are the indicators of compromise found on the page
+	IOCs []IOC `json:"iocs,omitempty"`
+	// Fingerprint identifies the page content for duplicate clustering
+	Fingerprint *PageFingerprint `json:"fingerprint,omitempty"`
+	// Assets are the hashed favicon, icons, scripts and stylesheets of the page
+	Assets []PageAsset `json:"assets,omitempty"`
+	// Technologies are the server and page technologies detected
+	Technologies []DetectedTech `json:"technologies,omitempty"`
+	// TLSCert is the certificate presented over HTTPS, also recorded when it
+	// was rejected
+	TLSCert *TLSCertificate `json:"tls_cert,omitempty"`
+	// Profile is the request profile the page was fetched with
+	Profile string `json:"profile,omitempty"`
+	// Redirects is the redirect chain followed, or stopped, by the request
+	Redirects []RedirectHop `json:"redirects,omitempty"`
+	// Challenge is the anti-DDoS queue or CAPTCHA the page was gated by
+	Challenge *ChallengeInfo `json:"challenge,omitempty"`
+	// Session is the cookie jar the page was fetched with; LoggedOut is set
+	// when the page still showed the session's logged-out marker
+	Session   string `json:"session,omitempty"`
+	LoggedOut bool   `json:"logged_out,omitempty"`
+	// Leaks are details from the opt-in leak checks that may reveal the
+	// service's real location
+	Leaks []LeakFinding `json:"leaks,omitempty"`
+
+	// Onion and clearnet mirrors
+	OnionLocation     string   `json:"onion_location,omitempty"`
+	OnionLocationMeta string   `json:"onion_location_meta,omitempty"`
+	PageCanonical     string   `json:"page_canonical,omitempty"`
+	OpenGraphURL      string   `json:"og_url,omitempty"`
+	ClearnetLinks     []string `json:"clearnet_links,omitempty"`
+
+	// Crawl mode links each page to the seed target and the page it was found on
+	SeedURL   string `json:"seed_url,omitempty"`
+	ParentURL string `json:"parent_url,omitempty"`
+	Depth     int    `json:"depth,omitempty"`
 }
 
 // ScanReport contains overall scan statistics
 type ScanReport struct {
-	TotalURLs  int          `json:"total_urls"`
-	Successful int          `json:"successful"`
-	Failed     int          `json:"failed"`
-	StartTime  time.Time    `json:"start_time"`
-	EndTime    time.Time    `json:"end_time"`
-	Results    []ScanResult `json:"results"`
+	TotalURLs  int               `json:"total_urls"`
+	Successful int               `json:"successful"`
+	Failed     int               `json:"failed"`
+	StartTime  time.Time         `json:"start_time"`
+	EndTime    time.Time         `json:"end_time"`
+	Results    []ScanResult      `json:"results"`
+	Duplicates []DuplicateTarget `json:"duplicates,omitempty"`
+	// Gated is the number of targets left behind a queue or CAPTCHA page
+	Gated int `json:"gated,omitempty"`
+
+	// Availability is filled in by monitor mode from the check history
+	Availability []TargetAvailability `json:"availability,omitempty"`
+	// Changes compares each result with the previous scan
+	Changes []ContentChange `json:"changes,omitempty"`
+	// DiscoveredOnions lists onion services found on fetched pages
+	DiscoveredOnions []DiscoveredOnion `json:"discovered_onions,omitempty"`
+	// IOCs are the indicators found on all pages, deduplicated across the run
+	IOCs []ReportIOC `json:"iocs,omitempty"`
+	// Clusters groups pages with duplicate or near-duplicate content
+	Clusters []PageCluster `json:"clusters,omitempty"`
+	// SharedAssets lists static assets served by more than one target
+	SharedAssets []SharedAsset `json:"shared_assets,omitempty"`
+	// SharedCertificates lists TLS certificates presented by more than one target
+	SharedCertificates []SharedCertificate `json:"shared_certificates,omitempty"`
+	// Technologies rolls up the detected technologies across all pages
+	Technologies []TechnologyUsage `json:"technologies,omitempty"`
+	// OnionMappings relates the onion and clearnet addresses of targets
+	OnionMappings []OnionMapping `json:"onion_mappings,omitempty"`
 }
 
 // Target represents a single target entry
 type Target struct {
-	URL          string `yaml:"url"`
-	Type         string `yaml:"type,omitempty"`
-	Name         string `yaml:"name,omitempty"`
-	MockResponse string `yaml:"mock_response,omitempty"`
+	URL          string       `yaml:"url"`
+	Type         string       `yaml:"type,omitempty"`
+	Name         string       `yaml:"name,omitempty"`
+	MockResponse string       `yaml:"mock_response,omitempty"`
+	Tags         []string     `yaml:"tags,omitempty"`
+	Crawl        *CrawlConfig `yaml:"crawl,omitempty"`
+	// TLSPins are SHA-256 certificate fingerprints accepted for this host
+	// instead of normal verification
+	TLSPins []string `yaml:"tls_pins,omitempty"`
+	// RateLimit overrides the default rate limit for this target's host
+	RateLimit *RateLimit `yaml:"rate_limit,omitempty"`
+	// Session names the cookie jar the target's host uses
+	Session string `yaml:"session,omitempty"`
+
+	// CanonicalURL is the normalized form of URL, filled in on load
+	CanonicalURL string `yaml:"-"`
 }
 
 // YAMLConfig represents the YAML file structure
 type YAMLConfig struct {
-	Targets []Target `yaml:"targets"`
+	Targets   []Target   `yaml:"targets"`
+	Schedules []Schedule `yaml:"schedules,omitempty"`
+	Watchlist string     `yaml:"watchlist,omitempty"`
+	Assets    bool       `yaml:"assets,omitempty"`
+	// LeakChecks probes onion hosts for pages and headers that leak their location
+	LeakChecks bool `yaml:"leak_checks,omitempty"`
+	// Technologies is a rules file replacing the built-in technology rules
+	Technologies string `yaml:"technologies,omitempty"`
+	// TLSVerify is the certificate verification mode: verify or skip-verify-onion
+	TLSVerify string `yaml:"tls_verify,omitempty"`
+	// Redirects is the redirect mode: follow-all, same-host-only, onion-only or none
+	Redirects    string `yaml:"redirects,omitempty"`
+	MaxRedirects *int   `yaml:"max_redirects,omitempty"`
+	// ClearnetAllow lists the clearnet hosts that may be contacted; every
+	// other non-onion host is blocked
+	ClearnetAllow []string `yaml:"clearnet_allow,omitempty"`
+	// RequestProfile selects the request headers: tor-browser, firefox-esr or custom
+	RequestProfile string          `yaml:"request_profile,omitempty"`
+	CustomProfile  *RequestProfile `yaml:"custom_profile,omitempty"`
+	// RateLimit is the default per-host rate limit
+	RateLimit *RateLimit `yaml:"rate_limit,omitempty"`
+	// RequestsPerMinute caps the requests sent to all hosts together (0 = no cap)
+	RequestsPerMinute int `yaml:"requests_per_minute,omitempty"`
+	// Challenges is a signatures file replacing the built-in queue and CAPTCHA signatures
+	Challenges string `yaml:"challenges,omitempty"`
+	// ChallengeRetries is how often queue and interstitial pages are refetched
+	ChallengeRetries int `yaml:"challenge_retries,omitempty"`
+	// ChallengeMaxWait caps the wait before each retry, e.g. "60s"
+	ChallengeMaxWait string `yaml:"challenge_max_wait,omitempty"`
+	// Sessions are the named cookie jars and login steps targets can use
+	Sessions map[string]*SessionConfig `yaml:"sessions,omitempty"`
+	// SessionDir is where cookie jars are saved between runs (default "sessions")
+	SessionDir string `yaml:"session_dir,omitempty"`
 }
 
 // readTargets reads the targets from a YAML or TXT file
 func readTargets(filePath string) ([]Target, error) {
+	config, err := readConfig(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return config.Targets, nil
+}
+
+// readConfig reads the full configuration from a YAML file, or a plain
+// target list from a TXT file
+func readConfig(filePath string) (*YAMLConfig, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
@@ -63,22 +196,23 @@ func readTargets(filePath string) ([]Target, error) {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	var targets []Target
-
 	// Try to parse as YAML first
 	var config YAMLConfig
 	err = yaml.Unmarshal(data, &config)
 	if err == nil && len(config.Targets) > 0 {
 		// Successfully parsed as YAML
+		var targets []Target
 		for _, target := range config.Targets {
 			if target.URL != "" {
-				targets = append(targets, target)
+				targets = append(targets, withCanonicalURL(target))
 			}
 		}
-		return targets, nil
+		config.Targets = targets
+		return &config, nil
 	}
 
 	// Fall back to line-by-line parsing for TXT format
+	config = YAMLConfig{}
 	scanner := bufio.NewScanner(strings.NewReader(string(data)))
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -86,46 +220,146 @@ func readTargets(filePath string) ([]Target, error) {
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		targets = append(targets, Target{URL: line})
+		config.Targets = append(config.Targets, withCanonicalURL(Target{URL: line}))
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("error reading file: %w", err)
 	}
 
-	return targets, nil
+	return &config, nil
 }
 
-// createTorClient creates an HTTP client configured to use Tor proxy
-func createTorClient() (*http.Client, error) {
+// withCanonicalURL fills in the target's canonical URL, falling back to the
+// URL as written when it cannot be normalized
+func withCanonicalURL(target Target) Target {
+	canonical, err := normalizeURL(target.URL)
+	if err != nil {
+		fmt.Printf("[WARN] Could not normalize %s: %v\n", target.URL, err)
+		canonical = strings.TrimSpace(target.URL)
+	}
+	target.CanonicalURL = canonical
+	return target
+}
+
+// createTorDialer returns a SOCKS5 dialer for the local Tor proxy
+func createTorDialer() (proxy.Dialer, error) {
 	// Try connecting to Tor SOCKS5 proxy (9150 for Tor Browser, 9050 for standard Tor)
-	dialer, err := proxy.SOCKS5("tcp", "127.0.0.1:9150", nil, proxy.Direct)
+	disableLocalDNS()
+	dialer, err := proxy.SOCKS5("tcp", "127.0.0.1:9150", nil, torOnlyForward{proxyAddr: "127.0.0.1:9150"})
 	if err != nil {
 		// Try alternative port if first fails
 		fmt.Println("[WARN] Could not connect to port 9150, trying 9050...")
-		dialer, err = proxy.SOCKS5("tcp", "127.0.0.1:9050", nil, proxy.Direct)
+		dialer, err = proxy.SOCKS5("tcp", "127.0.0.1:9050", nil, torOnlyForward{proxyAddr: "127.0.0.1:9050"})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create SOCKS5 dialer: %w", err)
 		}
 	}
+	return dialer, nil
+}
+
+// ClientOptions configures the Tor HTTP client
+type ClientOptions struct {
+	// TLS decides which server certificates are accepted
+	TLS TLSPolicy
+	// Redirects decides which redirects are followed
+	Redirects RedirectPolicy
+	// Egress decides which hosts may be connected to
+	Egress EgressPolicy
+	// Profile is the browser the request headers imitate
+	Profile RequestProfile
+	// RateLimiter spaces out requests per host and overall
+	RateLimiter *rateLimiter
+	// Sessions holds the cookies of the targets that use a session
+	Sessions *sessionJar
+}
+
+// newClientOptions builds the client settings from the config
+func newClientOptions(config *YAMLConfig) (ClientOptions, error) {
+	var options ClientOptions
+	var err error
+	if options.TLS, err = newTLSPolicy(config); err != nil {
+		return options, err
+	}
+	if options.Redirects, err = newRedirectPolicy(config); err != nil {
+		return options, err
+	}
+	if options.Egress, err = newEgressPolicy(config); err != nil {
+		return options, err
+	}
+	if options.Profile, err = newRequestProfile(config); err != nil {
+		return options, err
+	}
+	if options.RateLimiter, err = newRateLimiter(config); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// createTorClient creates an HTTP client configured to use Tor proxy
+func createTorClient(options ClientOptions) (*http.Client, error) {
+	dialer, err := createTorDialer()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every connection is checked against the egress policy before it
+	// reaches Tor; the hostname is passed on unresolved
+	dial := func(network, addr string) (net.Conn, error) {
+		if err := options.Egress.check(addr); err != nil {
+			return nil, err
+		}
+		return dialer.Dial(network, addr)
+	}
 
-	// Create custom transport using the Tor dialer with DialContext support
+	// Create custom transport using the Tor dialer with DialContext support.
+	// TLS is handled here rather than by the transport so the request
+	// headers can be reordered above it.
 	transport := &http.Transport{
 		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialer.Dial(network, addr)
+			conn, err := dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return options.Profile.wrapConn(conn), nil
+		},
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial(network, addr)
+			if err != nil {
+				return nil, err
+			}
+			host, _, _ := net.SplitHostPort(addr)
+			config := options.TLS.tlsConfig()
+			config.ServerName = host
+			tlsConn := tls.Client(conn, config)
+
+			handshakeCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+			defer cancel()
+			if err := tlsConn.HandshakeContext(handshakeCtx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			recordTLSState(ctx, tlsConn.ConnectionState())
+			return options.Profile.wrapConn(tlsConn), nil
 		},
 		// Additional security settings
 		DisableKeepAlives:     true,
 		DisableCompression:    true,
 		MaxIdleConnsPerHost:   1,
-		TLSHandshakeTimeout:   20 * time.Second,
 		ResponseHeaderTimeout: 20 * time.Second,
 	}
 
 	// Create HTTP client with custom transport
 	client := &http.Client{
-		Transport: transport,
-		Timeout:   30 * time.Second,
+		Transport: &profileTransport{
+			base:    &rateLimitTransport{base: transport, limiter: options.RateLimiter},
+			profile: options.Profile,
+		},
+		CheckRedirect: options.Redirects.checkRedirect,
+		Timeout:       30 * time.Second,
+	}
+	if options.Sessions != nil {
+		client.Jar = options.Sessions
 	}
 
 	return client, nil
@@ -135,8 +369,11 @@ func createTorClient() (*http.Client, error) {
 func scanURL(client *http.Client, target Target) ScanResult {
 	url := target.URL
 	result := ScanResult{
-		URL:       url,
-		Timestamp: time.Now(),
+		URL:          url,
+		CanonicalURL: target.CanonicalURL,
+		Name:         target.Name,
+		Type:         target.Type,
+		Timestamp:    time.Now(),
 	}
 
 	// Check if mock response is provided
@@ -144,14 +381,13 @@ func scanURL(client *http.Client, target Target) ScanResult {
 		result.StatusCode = 200
 		result.Status = "SUCCESS"
 		result.Content = target.MockResponse
+		result.ContentType = "text/html"
 		fmt.Printf("[SUCCESS] Scanning: %s -> Status: 200 (mocked)\n", url)
 		return result
 	}
 
-	// Ensure URL has http:// prefix
-	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
-		url = "http://" + url
-	}
+	// Fetch the URL as written; the canonical URL may be a different resource
+	url = requestURL(url)
 
 	fmt.Printf("[INFO] Scanning: %s\n", url)
 
@@ -163,14 +399,29 @@ func scanURL(client *http.Client, target Target) ScanResult {
 		return result
 	}
 
-	// Set a reasonable User-Agent
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:91.0) Gecko/20100101 Firefox/91.0")
+	// Headers come from the client's request profile
+	req, chain := withRedirectChain(req)
+	req, tlsState := withTLSState(req)
+	result.Profile = clientProfile(client)
 
+	start := time.Now()
 	resp, err := client.Do(req)
+	result.LatencyMS = time.Since(start).Milliseconds()
+	result.Redirects = *chain
+	if err != nil && isEgressBlocked(err) {
+		result.Status = "BLOCKED"
+		result.Error = fmt.Sprintf("Request blocked: %v", err)
+		fmt.Printf("[WARN] Scanning: %s -> BLOCKED (%v)\n", url, err)
+		return result
+	}
 	if err != nil {
 		result.Status = "FAILED"
 		result.Error = fmt.Sprintf("Request failed: %v", err)
 		result.StatusCode = 0
+		var certErr *tlsCertError
+		if errors.As(err, &certErr) {
+			result.TLSCert = &certErr.cert
+		}
 		fmt.Printf("[ERR] Scanning: %s -> FAILED (%v)\n", url, err)
 		return result
 	}
@@ -178,6 +429,13 @@ func scanURL(client *http.Client, target Target) ScanResult {
 
 	result.StatusCode = resp.StatusCode
 	result.Status = "SUCCESS"
+	result.ContentType = resp.Header.Get("Content-Type")
+	result.Headers = resp.Header
+	result.OnionLocation = resp.Header.Get("Onion-Location")
+	result.TLSCert = captureCertificate(tlsState)
+	if final := resp.Request.URL.String(); final != url {
+		result.FinalURL = final
+	}
 
 	// Read response body (limit to 1MB to avoid huge files)
 	limitedReader := io.LimitReader(resp.Body, 1024*1024)
@@ -193,6 +451,38 @@ func scanURL(client *http.Client, target Target) ScanResult {
 	return result
 }
 
+// rescanResult fetches rawURL again in place of an earlier result, keeping
+// the result's identity and position in the crawl tree
+func rescanResult(client *http.Client, result ScanResult, rawURL string) ScanResult {
+	rescanned := scanURL(client, Target{URL: rawURL, CanonicalURL: rawURL, Name: result.Name, Type: result.Type})
+	rescanned.URL, rescanned.CanonicalURL = result.URL, result.CanonicalURL
+	if rescanned.FinalURL == "" && rawURL != requestURL(result.URL) {
+		rescanned.FinalURL = rawURL
+	}
+	rescanned.SeedURL, rescanned.ParentURL, rescanned.Depth = result.SeedURL, result.ParentURL, result.Depth
+	return rescanned
+}
+
+// fetchURL performs a GET with the scanner's headers and reads up to limit
+// bytes of the body
+func fetchURL(client *http.Client, rawURL string, limit int64) (*http.Response, []byte, error) {
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return resp, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	return resp, body, nil
+}
+
 // generateHTMLReport generates a detailed HTML report
 func generateHTMLReport(report ScanReport) string {
 	duration := report.EndTime.Sub(report.StartTime)
@@ -215,7 +505,7 @@ func generateHTMLReport(report ScanReport) string {
         }
         body {
             font-family: 'Segoe UI', Tahoma, Geneva, Verdana, sans-serif;
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
             padding: 20px;
             min-height: 100vh;
         }
@@ -228,7 +518,7 @@ func generateHTMLReport(report ScanReport) string {
             overflow: hidden;
         }
         .header {
-            background: linear-gradient(135deg, #1a1a2e 0%, #16213e 100%);
+            background: linear-gradient(135deg, #1a1a2e 0%%, #16213e 100%%);
             color: white;
             padding: 40px 20px;
             text-align: center;
@@ -251,7 +541,7 @@ func generateHTMLReport(report ScanReport) string {
             margin-bottom: 40px;
         }
         .stat-card {
-            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
             color: white;
             padding: 20px;
             border-radius: 8px;
@@ -326,7 +616,7 @@ func generateHTMLReport(report ScanReport) string {
         }
         .progress-fill {
             height: 100%%;
-            background: linear-gradient(90deg, #27ae60 0%, #2ecc71 100%);
+            background: linear-gradient(90deg, #27ae60 0%%, #2ecc71 100%%);
             display: flex;
             align-items: center;
             justify-content: center;
@@ -391,6 +681,7 @@ func generateHTMLReport(report ScanReport) string {
                 <thead>
                     <tr>
                         <th>URL</th>
+                        <th>Title</th>
                         <th>Status</th>
                         <th>HTTP Code</th>
                         <th>Timestamp</th>
@@ -406,9 +697,9 @@ func generateHTMLReport(report ScanReport) string {
 	// Add result rows
 	for _, result := range report.Results {
 		statusClass := "status-success"
-		if result.Status == "FAILED" || result.Status == "ERROR" {
+		if result.Status == "FAILED" || result.Status == "ERROR" || result.Status == "BLOCKED" {
 			statusClass = "status-failed"
-		} else if result.Status == "PARTIAL" {
+		} else if result.Status == "PARTIAL" || result.Status == "CHALLENGE" {
 			statusClass = "status-error"
 		}
 
@@ -423,18 +714,32 @@ func generateHTMLReport(report ScanReport) string {
 		html += fmt.Sprintf(`
                     <tr>
                         <td><strong>%s</strong></td>
+                        <td>%s</td>
                         <td class="%s">%s</td>
                         <td>%d</td>
                         <td>%s</td>
                         <td>%s</td>
                     </tr>`,
-			result.URL, statusClass, result.Status, result.StatusCode,
-			result.Timestamp.Format("15:04:05"), details)
+			escapeHTML(result.URL), escapeHTML(result.Title), statusClass, result.Status, result.StatusCode,
+			result.Timestamp.Format("15:04:05"), escapeHTML(details))
 	}
 
 	html += `
                 </tbody>
-            </table>
+            </table>`
+
+	html += generateMatchesSection(report)
+	html += generateClustersSection(report.Clusters)
+	html += generateSharedAssetsSection(report.SharedAssets)
+	html += generateCertificatesSection(report.SharedCertificates)
+	html += generateChallengesSection(report.Results)
+	html += generateTechnologiesSection(report.Technologies)
+	html += generateLeaksSection(report)
+	html += generateMirrorsSection(report.OnionMappings)
+	html += generateChangesSection(report.Changes)
+	html += generateAvailabilitySection(report.Availability)
+
+	html += `
 
             <div class="footer">
                 <p>Generated: ` + time.Now().Format("2006-01-02 15:04:05") + `</p>
@@ -522,6 +827,21 @@ Success Rate:     %.2f%%
 
 	logFile.WriteString(logContent)
 
+	if len(report.Duplicates) > 0 {
+		logFile.WriteString(fmt.Sprintf("Merged %d duplicate target(s):\n", len(report.Duplicates)))
+		for _, dup := range report.Duplicates {
+			logFile.WriteString(fmt.Sprintf("    %s -> %s\n", dup.URL, dup.MergedInto))
+		}
+		logFile.WriteString("\n")
+	}
+	if report.Gated > 0 {
+		logFile.WriteString(fmt.Sprintf("Gated by anti-DDoS queues or CAPTCHAs: %d target(s)\n\n", report.Gated))
+	}
+
+	logFile.WriteString(writeMatchesText(report))
+	logFile.WriteString(writeTechnologiesText(report.Technologies))
+	logFile.WriteString(writeLeaksText(report))
+
 	for i, result := range report.Results {
 		logLine := fmt.Sprintf(`
 [%d] URL: %s
@@ -530,6 +850,51 @@ Success Rate:     %.2f%%
     Timestamp:    %s
 `, i+1, result.URL, result.Status, result.StatusCode, result.Timestamp.Format("2006-01-02 15:04:05"))
 
+		if result.CanonicalURL != "" && result.CanonicalURL != result.URL {
+			logLine += fmt.Sprintf("    Canonical:    %s\n", result.CanonicalURL)
+		}
+		if result.ParentURL != "" {
+			logLine += fmt.Sprintf("    Found on:     %s (depth %d)\n", result.ParentURL, result.Depth)
+		}
+		if result.Title != "" {
+			logLine += fmt.Sprintf("    Title:        %s\n", result.Title)
+		}
+		if result.MetaDescription != "" {
+			logLine += fmt.Sprintf("    Description:  %s\n", result.MetaDescription)
+		}
+		if result.MetaGenerator != "" {
+			logLine += fmt.Sprintf("    Generator:    %s\n", result.MetaGenerator)
+		}
+		if result.Language != "" {
+			logLine += fmt.Sprintf("    Language:     %s\n", result.Language)
+		}
+		if result.OnionLocation != "" {
+			logLine += fmt.Sprintf("    Onion:        %s\n", result.OnionLocation)
+		} else if result.OnionLocationMeta != "" {
+			logLine += fmt.Sprintf("    Onion:        %s (from page)\n", result.OnionLocationMeta)
+		}
+		if result.PageCanonical != "" && result.PageCanonical != resultKey(result) {
+			logLine += fmt.Sprintf("    Canonical:    %s (from page)\n", result.PageCanonical)
+		}
+		if len(result.Technologies) > 0 {
+			logLine += fmt.Sprintf("    Technologies: %s\n", formatTechnologies(result.Technologies))
+		}
+		if len(result.Redirects) > 0 {
+			logLine += fmt.Sprintf("    Redirects:    %s\n", formatRedirects(result.Redirects))
+		}
+		if result.TLSCert != nil {
+			logLine += fmt.Sprintf("    Certificate:  %s\n", formatCertificate(result.TLSCert))
+		}
+		if result.Challenge != nil {
+			logLine += fmt.Sprintf("    Challenge:    %s\n", formatChallenge(result.Challenge))
+		}
+		if result.Session != "" {
+			session := result.Session
+			if result.LoggedOut {
+				session += " (logged out)"
+			}
+			logLine += fmt.Sprintf("    Session:      %s\n", session)
+		}
 		if result.Error != "" {
 			logLine += fmt.Sprintf("    Error:        %s\n", result.Error)
 		}
@@ -554,7 +919,7 @@ Success Rate:     %.2f%%
 	}
 	defer csvFile.Close()
 
-	csvFile.WriteString("URL,Status,HTTP_Code,Timestamp,Content_Size,Error\n")
+	csvFile.WriteString("URL,Title,Status,HTTP_Code,Timestamp,Content_Size,Error\n")
 	for _, result := range report.Results {
 		contentSize := 0
 		if result.Content != "" {
@@ -564,9 +929,9 @@ Success Rate:     %.2f%%
 		if errorMsg == "" {
 			errorMsg = "None"
 		}
-		csvLine := fmt.Sprintf("%s,%s,%d,%s,%d,\"%s\"\n",
-			result.URL, result.Status, result.StatusCode,
-			result.Timestamp.Format(time.RFC3339), contentSize, errorMsg)
+		csvLine := fmt.Sprintf("%s,%s,%s,%d,%s,%d,%s\n",
+			result.URL, csvQuote(result.Title), result.Status, result.StatusCode,
+			result.Timestamp.Format(time.RFC3339), contentSize, csvQuote(errorMsg))
 		csvFile.WriteString(csvLine)
 	}
 	fmt.Printf("[INFO] 📊 CSV report saved to: %s\n", csvPath)
@@ -574,8 +939,7 @@ Success Rate:     %.2f%%
 	// 5. Save individual HTML content files
 	for _, result := range report.Results {
 		if result.Status == "SUCCESS" && result.Content != "" {
-			filename := strings.ReplaceAll(strings.ReplaceAll(result.URL, "http://", ""), "/", "_")
-			filename = strings.TrimSuffix(filename, "_")
+			filename := contentFileName(result.URL)
 			contentPath := filepath.Join(outputDir, "content", filename+".html")
 
 			os.MkdirAll(filepath.Dir(contentPath), 0755)
@@ -585,7 +949,37 @@ Success Rate:     %.2f%%
 		}
 	}
 
-	// 6. Save summary report
+	// 6. Save unified diffs of pages changed since the previous scan
+	if err := writeContentDiff(report.Changes, filepath.Join(outputDir, "content_diff.txt")); err != nil {
+		fmt.Printf("[WARN] %v\n", err)
+	}
+
+	// 7. Save onion services discovered on the fetched pages
+	if len(report.DiscoveredOnions) > 0 {
+		discoveredPath := filepath.Join(outputDir, "discovered_onions.yaml")
+		if err := writeDiscoveredOnions(report.DiscoveredOnions, discoveredPath); err != nil {
+			fmt.Printf("[WARN] %v\n", err)
+		} else {
+			fmt.Printf("[INFO] 🧅 Discovered onions saved to: %s\n", discoveredPath)
+		}
+	}
+
+	// 8. Save watchlist matches
+	matchesPath := filepath.Join(outputDir, "matches.csv")
+	if err := writeMatchesCSV(report, matchesPath); err != nil {
+		fmt.Printf("[WARN] %v\n", err)
+	} else if countMatchesAtLeast(report, "info") > 0 {
+		fmt.Printf("[INFO] 🚨 Watchlist matches saved to: %s\n", matchesPath)
+	}
+
+	// 9. Save extracted indicators
+	if err := writeIOCs(report.IOCs, outputDir); err != nil {
+		fmt.Printf("[WARN] %v\n", err)
+	} else if len(report.IOCs) > 0 {
+		fmt.Printf("[INFO] 🔎 Indicators saved to: %s\n", filepath.Join(outputDir, "iocs.json"))
+	}
+
+	// 10. Save summary report
 	summaryPath := filepath.Join(outputDir, "SCAN_SUMMARY.txt")
 	summaryFile, err := os.Create(summaryPath)
 	if err != nil {
@@ -612,6 +1006,11 @@ Success Rate:     %.2f%%
    • scan_report.txt   - Detailed text report
    • scan_report.csv   - CSV format for spreadsheets
    • content/          - Individual HTML files for each successful scan
+   • content_diff.txt  - Text diffs of pages changed since the previous scan
+   • scans.db          - Results database of all runs (see: tor-scraper query)
+   • discovered_onions.yaml - New onion services found on fetched pages
+   • matches.csv       - Watchlist matches with severity and snippets
+   • iocs.json/iocs.csv - Indicators of compromise found on fetched pages
    • SCAN_SUMMARY.txt  - This summary file
 
 💡 NEXT STEPS:
@@ -635,19 +1034,291 @@ Generated: %s
 	return nil
 }
 
+// loadTargets reads and deduplicates the targets file, logging merged duplicates
+func loadTargets(targetsFile string) (*YAMLConfig, []DuplicateTarget, error) {
+	fmt.Printf("[INFO] Reading targets from: %s\n", targetsFile)
+	config, err := readConfig(targetsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read targets: %w", err)
+	}
+
+	if len(config.Targets) == 0 {
+		return nil, nil, fmt.Errorf("no targets found in file")
+	}
+
+	if err := checkTargetSessions(config); err != nil {
+		return nil, nil, err
+	}
+
+	targets, duplicates := dedupeTargets(config.Targets)
+	for _, dup := range duplicates {
+		fmt.Printf("[WARN] Duplicate target %s merged into %s (%s)\n", dup.URL, dup.MergedInto, dup.CanonicalURL)
+	}
+	config.Targets = targets
+
+	fmt.Printf("[INFO] Found %d targets", len(targets))
+	if len(duplicates) > 0 {
+		fmt.Printf(" (%d duplicates merged)", len(duplicates))
+	}
+	fmt.Println()
+
+	return config, duplicates, nil
+}
+
+// runScan scans every target in order and collects the results into a report
+func runScan(client *http.Client, targets []Target) ScanReport {
+	report := ScanReport{
+		TotalURLs: len(targets),
+		StartTime: time.Now(),
+	}
+
+	// Requests are spaced out by the client's rate limiter
+	for _, target := range targets {
+		result := scanURL(client, target)
+		report.Results = append(report.Results, result)
+
+		if result.Status == "SUCCESS" {
+			report.Successful++
+		} else {
+			report.Failed++
+		}
+	}
+
+	report.EndTime = time.Now()
+	return report
+}
+
+// analysisOptions configures the post-scan analysis steps
+type analysisOptions struct {
+	// Targets is the full target list, which may be more than was scanned
+	Targets   []Target
+	Watchlist *Watchlist
+	// FetchAssets fetches and hashes page assets after scanning
+	FetchAssets  bool
+	LeakChecks   bool
+	Technologies *TechRules
+	// Challenges detects and retries queue, interstitial and CAPTCHA pages
+	Challenges challengeSettings
+	// Client configures the Tor HTTP client
+	Client ClientOptions
+}
+
+// newAnalysisOptions loads the analysis settings referenced by the config.
+// Relative paths in the config are resolved against the targets file's
+// directory; a non-empty watchlistFlag replaces the configured watchlist.
+func newAnalysisOptions(config *YAMLConfig, targetsFile, watchlistFlag string) (analysisOptions, error) {
+	options := analysisOptions{Targets: config.Targets, FetchAssets: config.Assets, LeakChecks: config.LeakChecks}
+
+	watchlistPath := resolveConfigPath(targetsFile, config.Watchlist)
+	if watchlistFlag != "" {
+		watchlistPath = watchlistFlag
+	}
+	if watchlistPath != "" {
+		watchlist, err := loadWatchlist(watchlistPath)
+		if err != nil {
+			return options, err
+		}
+		fmt.Printf("[INFO] Loaded %d watchlist rules from: %s\n", len(watchlist.Rules), watchlistPath)
+		options.Watchlist = watchlist
+	}
+
+	technologiesPath := resolveConfigPath(targetsFile, config.Technologies)
+	technologies, err := loadTechRules(technologiesPath)
+	if err != nil {
+		return options, err
+	}
+	if technologiesPath != "" {
+		fmt.Printf("[INFO] Loaded %d technology rules from: %s\n", len(technologies.techs), technologiesPath)
+	}
+	options.Technologies = technologies
+
+	challengesPath := resolveConfigPath(targetsFile, config.Challenges)
+	challenges, err := loadChallengeRules(challengesPath)
+	if err != nil {
+		return options, err
+	}
+	if challengesPath != "" {
+		fmt.Printf("[INFO] Loaded %d challenge signatures from: %s\n", len(challenges.signatures), challengesPath)
+	}
+	if config.ChallengeRetries < 0 {
+		return options, fmt.Errorf("challenge_retries must not be negative")
+	}
+	options.Challenges = challengeSettings{Rules: challenges, Retries: config.ChallengeRetries, MaxWait: defaultChallengeMaxWait}
+	if config.ChallengeMaxWait != "" {
+		maxWait, err := time.ParseDuration(config.ChallengeMaxWait)
+		if err != nil || maxWait <= 0 {
+			return options, fmt.Errorf("invalid challenge_max_wait %q", config.ChallengeMaxWait)
+		}
+		options.Challenges.MaxWait = maxWait
+	}
+
+	client, err := newClientOptions(config)
+	if err != nil {
+		return options, err
+	}
+	options.Client = client
+	if options.Client.Sessions, err = newSessionJar(config, targetsFile); err != nil {
+		return options, err
+	}
+
+	return options, nil
+}
+
+// resolveConfigPath resolves a path from the targets file relative to its directory
+func resolveConfigPath(targetsFile, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(targetsFile), path)
+}
+
+// analyzeReport runs the post-scan analysis steps over a finished report
+func analyzeReport(report *ScanReport, options analysisOptions) {
+	matches := 0
+	for i := range report.Results {
+		extractPageInfo(&report.Results[i])
+		extractMirrorInfo(&report.Results[i])
+		matchWatchlist(options.Watchlist, &report.Results[i])
+		matches += len(report.Results[i].Matches)
+		report.Results[i].IOCs = extractIOCs(report.Results[i])
+		report.Results[i].Fingerprint = fingerprintPage(report.Results[i])
+		report.Results[i].Technologies = detectTechnologies(options.Technologies, report.Results[i])
+	}
+	report.Technologies = summarizeTechnologies(report.Results)
+	report.OnionMappings = mapOnionRelations(report.Results)
+	if matches > 0 {
+		fmt.Printf("[ALERT] %d watchlist matches (%d high severity or above)\n",
+			matches, countMatchesAtLeast(*report, "high"))
+	}
+
+	report.Clusters = clusterPages(report.Results)
+	for _, cluster := range report.Clusters {
+		if cluster.CrossTarget {
+			var urls []string
+			for _, member := range cluster.Members {
+				urls = append(urls, member.URL)
+			}
+			fmt.Printf("[WARN] Targets serve %s-duplicate content: %s\n", cluster.Match, strings.Join(urls, ", "))
+		}
+	}
+
+	report.SharedAssets = groupSharedAssets(report.Results)
+	if len(report.SharedAssets) > 0 {
+		fmt.Printf("[INFO] %d assets are shared between targets\n", len(report.SharedAssets))
+	}
+
+	report.SharedCertificates = groupSharedCertificates(report.Results)
+	if len(report.SharedCertificates) > 0 {
+		fmt.Printf("[INFO] %d TLS certificates are shared between targets\n", len(report.SharedCertificates))
+	}
+
+	report.IOCs = collectIOCs(report.Results)
+	if len(report.IOCs) > 0 {
+		fmt.Printf("[INFO] Extracted %d unique indicators\n", len(report.IOCs))
+	}
+
+	report.DiscoveredOnions = discoverOnions(report.Results, options.Targets)
+	if len(report.DiscoveredOnions) > 0 {
+		fmt.Printf("[INFO] Discovered %d new onion services\n", len(report.DiscoveredOnions))
+	}
+}
+
+// printUsage prints the command line help
+func printUsage() {
+	fmt.Println("Usage: tor-scraper [-watchlist file] [-fail-on severity] [-assets] [-leaks] [-tls-verify mode] [-redirects mode] [-clearnet-allow hosts] [-profile name] [-challenge-retries n] <targets_file> [output_directory]")
+	fmt.Println("       tor-scraper daemon [flags] <targets_file> [output_directory]")
+	fmt.Println("       tor-scraper monitor [flags] <targets_file> [output_directory]")
+	fmt.Println("       tor-scraper crawl [flags] <targets_file> [output_directory]")
+	fmt.Println("       tor-scraper diff <old_report.json> <new_report.json> [output_directory]")
+	fmt.Println("       tor-scraper query [flags] <runs|target|results> [args]")
+	fmt.Println("       tor-scraper export [flags] <scan_report.json> [output_file]")
+	fmt.Println("       tor-scraper probe [flags] <targets_file> [output_directory]")
+	fmt.Println("Example: go run . targets.yaml")
+	fmt.Println("\nMake sure Tor service is running!")
+}
+
+// csvQuote quotes a free-text CSV field, doubling embedded quotes
+func csvQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// contentFileName turns a URL into a safe file name for its saved content
+func contentFileName(url string) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(url, "http://"), "https://")
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, name)
+	return strings.TrimSuffix(name, "_")
+}
+
 // main function
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: tor-scraper <targets_file> [output_directory]")
-		fmt.Println("Example: go run main.go targets.yaml")
-		fmt.Println("\nMake sure Tor service is running!")
+		printUsage()
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "daemon":
+		if err := runDaemon(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	case "monitor":
+		if err := runMonitor(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	case "diff":
+		if err := runDiff(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	case "query":
+		if err := runQuery(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	case "crawl":
+		if err := runCrawl(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	case "export":
+		if err := runExport(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	case "probe":
+		if err := runProbeCommand(os.Args[2:]); err != nil {
+			exitWith(err)
+		}
+		return
+	case "-h", "--help", "help":
+		printUsage()
+		return
+	}
+
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	flags := addScanFlags(fs)
+	fs.Usage = printUsage
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() < 1 {
+		printUsage()
 		os.Exit(1)
 	}
+	if err := flags.validate(); err != nil {
+		exitWith(err)
+	}
 
-	targetsFile := os.Args[1]
+	targetsFile := fs.Arg(0)
 	outputDir := "output"
-	if len(os.Args) > 2 {
-		outputDir = os.Args[2]
+	if fs.NArg() > 1 {
+		outputDir = fs.Arg(1)
 	}
 
 	fmt.Println("========================================")
@@ -656,24 +1327,15 @@ func main() {
 	fmt.Println()
 
 	// Read targets from file
-	fmt.Printf("[INFO] Reading targets from: %s\n", targetsFile)
-	targets, err := readTargets(targetsFile)
+	config, duplicates, options, err := loadScanConfig(targetsFile, flags)
 	if err != nil {
-		fmt.Printf("[ERR] Failed to read targets: %v\n", err)
-		os.Exit(1)
+		exitWith(err)
 	}
-
-	if len(targets) == 0 {
-		fmt.Println("[ERR] No targets found in file")
-		os.Exit(1)
-	}
-
-	fmt.Printf("[INFO] Found %d targets\n", len(targets))
 	fmt.Println()
 
 	// Create Tor-enabled HTTP client
 	fmt.Println("[INFO] Connecting to Tor network...")
-	client, err := createTorClient()
+	client, err := createTorClient(options.Client)
 	if err != nil {
 		fmt.Printf("[ERR] Failed to create Tor client: %v\n", err)
 		fmt.Println("[INFO] Make sure Tor service is running on port 9050 or 9150")
@@ -683,45 +1345,28 @@ func main() {
 	fmt.Println()
 
 	// Start scanning
-	startTime := time.Now()
-	report := ScanReport{
-		TotalURLs: len(targets),
-		StartTime: startTime,
-	}
-
 	fmt.Println("[INFO] Starting scan...")
 	fmt.Println()
 
-	for _, target := range targets {
-		result := scanURL(client, target)
-		report.Results = append(report.Results, result)
-
-		if result.Status == "SUCCESS" {
-			report.Successful++
-		} else {
-			report.Failed++
-		}
-
-		// Add a small delay between requests to avoid overwhelming the network
-		time.Sleep(1 * time.Second)
-	}
-
-	endTime := time.Now()
-	report.EndTime = endTime
+	scan := func(client *http.Client) ScanReport { return runScan(client, config.Targets) }
+	report := runPipeline(client, options, duplicates, scan, loadPreviousReport(filepath.Join(outputDir, "scan_report.json")), true)
 
 	fmt.Println()
 	fmt.Println("========================================")
 	fmt.Println("           Scan Complete")
 	fmt.Println("========================================")
-	fmt.Printf("Duration: %v\n", endTime.Sub(startTime))
+	fmt.Printf("Duration: %v\n", report.EndTime.Sub(report.StartTime))
 	fmt.Printf("Successful: %d/%d\n", report.Successful, report.TotalURLs)
 	fmt.Println()
 
 	// Save report
-	if err := saveScanReport(report, outputDir); err != nil {
-		fmt.Printf("[ERR] Failed to save report: %v\n", err)
-		os.Exit(1)
+	if err := saveRun(report, outputDir, outputDir); err != nil {
+		exitWith(err)
 	}
 
 	fmt.Println("[SUCCESS] Scan complete!")
+
+	if flags.checkFailOn(report) {
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxClearnetLinks bounds the clearnet links stored per page
+const maxClearnetLinks = 100
+
+// Onion to clearnet relation sources
+const (
+	MirrorOnionLocationHeader = "onion_location_header"
+	MirrorOnionLocationMeta   = "onion_location_meta"
+	MirrorCanonical           = "canonical"
+	MirrorOpenGraphURL        = "og_url"
+	MirrorLink                = "link"
+)
+
+// OnionMapping relates an onion address and a clearnet address for a target
+type OnionMapping struct {
+	Target   string `json:"target"`
+	Name     string `json:"name,omitempty"`
+	Onion    string `json:"onion"`
+	Clearnet string `json:"clearnet"`
+	Source   string `json:"source"`
+}
+
+// isOnionURL reports whether a URL points at an onion service
+func isOnionURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(strings.TrimSuffix(u.Hostname(), ".")), ".onion")
+}
+
+// isClearnetURL reports whether a URL is an http(s) URL outside the onion space
+func isClearnetURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return false
+	}
+	return !isOnionURL(rawURL)
+}
+
+// extractMirrorInfo fills in the Onion-Location meta tag, the page's
+// canonical and og:url links and, on onion pages, its clearnet links
+func extractMirrorInfo(result *ScanResult) {
+	if !hasContent(*result) || !isHTMLContent(result.ContentType) {
+		return
+	}
+	doc, err := html.Parse(strings.NewReader(result.Content))
+	if err != nil {
+		return
+	}
+
+	base := servedURL(*result)
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return
+	}
+	resolve := func(ref string) string {
+		if resolved, err := baseURL.Parse(strings.TrimSpace(ref)); err == nil && ref != "" {
+			return resolved.String()
+		}
+		return ""
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "meta":
+				content := htmlAttr(n, "content")
+				if strings.EqualFold(htmlAttr(n, "http-equiv"), "onion-location") && result.OnionLocationMeta == "" {
+					result.OnionLocationMeta = strings.TrimSpace(content)
+				}
+				if strings.EqualFold(htmlAttr(n, "property"), "og:url") && result.OpenGraphURL == "" {
+					result.OpenGraphURL = resolve(content)
+				}
+			case "link":
+				for _, rel := range strings.Fields(strings.ToLower(htmlAttr(n, "rel"))) {
+					if rel == "canonical" && result.PageCanonical == "" {
+						result.PageCanonical = resolve(htmlAttr(n, "href"))
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if !isOnionURL(base) {
+		return
+	}
+	for _, link := range extractLinks(base, result.Content) {
+		if isClearnetURL(link.URL) && !containsString(result.ClearnetLinks, link.URL) && len(result.ClearnetLinks) < maxClearnetLinks {
+			result.ClearnetLinks = append(result.ClearnetLinks, link.URL)
+		}
+	}
+}
+
+// mapOnionRelations collects the onion to clearnet relationships found on
+// each target: Onion-Location on clearnet pages, and canonical, og:url and
+// linked clearnet hosts on onion pages
+func mapOnionRelations(results []ScanResult) []OnionMapping {
+	var mappings []OnionMapping
+	seen := make(map[OnionMapping]bool)
+	add := func(mapping OnionMapping) {
+		if !seen[mapping] {
+			seen[mapping] = true
+			mappings = append(mappings, mapping)
+		}
+	}
+
+	for _, result := range results {
+		page := resultKey(result)
+		if result.FinalURL != "" {
+			page = result.FinalURL
+		}
+
+		if isClearnetURL(page) {
+			if isOnionURL(result.OnionLocation) {
+				add(OnionMapping{Target: result.URL, Name: result.Name, Onion: result.OnionLocation, Clearnet: page, Source: MirrorOnionLocationHeader})
+			}
+			if isOnionURL(result.OnionLocationMeta) {
+				add(OnionMapping{Target: result.URL, Name: result.Name, Onion: result.OnionLocationMeta, Clearnet: page, Source: MirrorOnionLocationMeta})
+			}
+			continue
+		}
+		if !isOnionURL(page) {
+			continue
+		}
+
+		if isClearnetURL(result.PageCanonical) {
+			add(OnionMapping{Target: result.URL, Name: result.Name, Onion: page, Clearnet: result.PageCanonical, Source: MirrorCanonical})
+		}
+		if isClearnetURL(result.OpenGraphURL) {
+			add(OnionMapping{Target: result.URL, Name: result.Name, Onion: page, Clearnet: result.OpenGraphURL, Source: MirrorOpenGraphURL})
+		}
+		hosts := make(map[string]bool)
+		for _, link := range result.ClearnetLinks {
+			u, err := url.Parse(link)
+			if err != nil || hosts[u.Host] {
+				continue
+			}
+			hosts[u.Host] = true
+			add(OnionMapping{Target: result.URL, Name: result.Name, Onion: page, Clearnet: u.Scheme + "://" + u.Host + "/", Source: MirrorLink})
+		}
+	}
+	return mappings
+}
+
+// generateMirrorsSection renders the onion to clearnet mapping for the HTML report
+func generateMirrorsSection(mappings []OnionMapping) string {
+	if len(mappings) == 0 {
+		return ""
+	}
+
+	section := `
+
+            <h2>🪞 Onion ↔ Clearnet</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>Target</th>
+                        <th>Onion</th>
+                        <th>Clearnet</th>
+                        <th>Source</th>
+                    </tr>
+                </thead>
+                <tbody>`
+
+	for _, mapping := range mappings {
+		target := escapeHTML(mapping.Target)
+		if mapping.Name != "" {
+			target = "<strong>" + escapeHTML(mapping.Name) + "</strong><br>" + target
+		}
+		section += fmt.Sprintf(`
+                    <tr>
+                        <td>%s</td>
+                        <td>%s</td>
+                        <td>%s</td>
+                        <td>%s</td>
+                    </tr>`,
+			target, escapeHTML(mapping.Onion), escapeHTML(mapping.Clearnet), mapping.Source)
+	}
+
+	section += `
+                </tbody>
+            </table>`
+	return section
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOnionLocationHeaderAndMeta(t *testing.T) {
+	onion := "http://" + testOnionV3 + ".onion/"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Onion-Location", onion+"header")
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head>
+<meta http-equiv="Onion-Location" content=" ` + onion + `meta ">
+<meta http-equiv="onion-location" content="http://second.onion/">
+</head></html>`))
+	}))
+	defer server.Close()
+
+	result := scanURL(&http.Client{}, withCanonicalURL(Target{URL: server.URL + "/"}))
+	if result.Status != "SUCCESS" {
+		t.Fatalf("scanURL() status = %s (%s)", result.Status, result.Error)
+	}
+	extractMirrorInfo(&result)
+	if result.OnionLocation != onion+"header" {
+		t.Errorf("header Onion-Location = %q", result.OnionLocation)
+	}
+	if result.OnionLocationMeta != onion+"meta" {
+		t.Errorf("meta Onion-Location = %q, want the first tag, trimmed", result.OnionLocationMeta)
+	}
+
+	mappings := mapOnionRelations([]ScanResult{result})
+	if len(mappings) != 2 {
+		t.Fatalf("mappings = %+v, want one from the header and one from the meta tag", mappings)
+	}
+	if mappings[0].Source != MirrorOnionLocationHeader || mappings[0].Onion != onion+"header" || mappings[0].Clearnet != server.URL+"/" {
+		t.Errorf("first mapping = %+v", mappings[0])
+	}
+	if mappings[1].Source != MirrorOnionLocationMeta || mappings[1].Onion != onion+"meta" {
+		t.Errorf("second mapping = %+v", mappings[1])
+	}
+}
+
+func TestExtractMirrorInfoOnionPage(t *testing.T) {
+	page := "http://" + testOnionV3 + ".onion/news/"
+	result := ScanResult{
+		URL: page, Status: "SUCCESS", StatusCode: 200, ContentType: "text/html",
+		Content: `<html><head>
+<link rel="alternate canonical" href="https://news.example.com/">
+<meta property="og:url" content="/news/today">
+</head><body>
+<a href="https://news.example.com/about">About</a>
+<a href="https://news.example.com/contact">Contact</a>
+<a href="https://cdn.example.net/a.js">CDN</a>
+<a href="/local">Local</a>
+<a href="http://` + testOnionV2 + `.onion/">Other onion</a>
+</body></html>`,
+	}
+	extractMirrorInfo(&result)
+
+	if result.PageCanonical != "https://news.example.com/" {
+		t.Errorf("canonical = %q", result.PageCanonical)
+	}
+	if result.OpenGraphURL != "http://"+testOnionV3+".onion/news/today" {
+		t.Errorf("og:url = %q, want it resolved against the page", result.OpenGraphURL)
+	}
+	if len(result.ClearnetLinks) != 3 {
+		t.Errorf("clearnet links = %q, want the three clearnet links only", result.ClearnetLinks)
+	}
+}
+
+func TestMapOnionRelations(t *testing.T) {
+	onion := "http://" + testOnionV3 + ".onion/"
+	results := []ScanResult{
+		{
+			URL: onion, Name: "News",
+			PageCanonical: "https://news.example.com/",
+			// An og:url on the onion itself is not a clearnet relation
+			OpenGraphURL:  onion + "today",
+			ClearnetLinks: []string{"https://news.example.com/about", "https://news.example.com/contact", "http://cdn.example.net/a.js"},
+		},
+		{
+			URL: "http://abc.onion/", FinalURL: "https://moved.example.org/",
+			OnionLocation: onion,
+		},
+		// Onion-Location on an onion page and a clearnet page without one
+		{URL: onion + "x", OnionLocation: onion},
+		{URL: "https://plain.example.com/"},
+	}
+
+	want := []OnionMapping{
+		{Target: onion, Name: "News", Onion: onion, Clearnet: "https://news.example.com/", Source: MirrorCanonical},
+		{Target: onion, Name: "News", Onion: onion, Clearnet: "https://news.example.com/", Source: MirrorLink},
+		{Target: onion, Name: "News", Onion: onion, Clearnet: "http://cdn.example.net/", Source: MirrorLink},
+		{Target: "http://abc.onion/", Onion: onion, Clearnet: "https://moved.example.org/", Source: MirrorOnionLocationHeader},
+	}
+	got := mapOnionRelations(results)
+	if len(got) != len(want) {
+		t.Fatalf("mappings = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mapping %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
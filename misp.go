@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// MISPOptions are the event defaults set on the export command
+type MISPOptions struct {
+	Info          string
+	Distribution  int
+	ThreatLevelID int
+	Analysis      int
+}
+
+// MISPEvent is a MISP event in the JSON format accepted by event import
+type MISPEvent struct {
+	UUID          string          `json:"uuid"`
+	Info          string          `json:"info"`
+	Date          string          `json:"date"`
+	Timestamp     string          `json:"timestamp"`
+	Published     bool            `json:"published"`
+	Distribution  string          `json:"distribution"`
+	ThreatLevelID string          `json:"threat_level_id"`
+	Analysis      string          `json:"analysis"`
+	Tag           []MISPTag       `json:"Tag,omitempty"`
+	Attribute     []MISPAttribute `json:"Attribute"`
+	Object        []MISPObject    `json:"Object"`
+}
+
+// MISPTag is a tag on an event or attribute
+type MISPTag struct {
+	Name string `json:"name"`
+}
+
+// MISPAttribute is a single MISP attribute, standalone or inside an object
+type MISPAttribute struct {
+	UUID           string    `json:"uuid"`
+	Type           string    `json:"type"`
+	Category       string    `json:"category"`
+	Value          string    `json:"value"`
+	ToIDs          bool      `json:"to_ids"`
+	Distribution   string    `json:"distribution"`
+	Timestamp      string    `json:"timestamp"`
+	Comment        string    `json:"comment,omitempty"`
+	ObjectRelation string    `json:"object_relation,omitempty"`
+	Tag            []MISPTag `json:"Tag,omitempty"`
+}
+
+// MISPObject groups the attributes describing one target
+type MISPObject struct {
+	UUID            string          `json:"uuid"`
+	Name            string          `json:"name"`
+	MetaCategory    string          `json:"meta-category"`
+	Description     string          `json:"description"`
+	TemplateUUID    string          `json:"template_uuid"`
+	TemplateVersion string          `json:"template_version"`
+	Distribution    string          `json:"distribution"`
+	Timestamp       string          `json:"timestamp"`
+	Comment         string          `json:"comment,omitempty"`
+	Attribute       []MISPAttribute `json:"Attribute"`
+}
+
+const (
+	// mispInheritDistribution makes attributes and objects use the event's distribution
+	mispInheritDistribution = "5"
+	// mispURLTemplateUUID and mispURLTemplateVersion identify the url object
+	// template of the MISP object definitions, whose relations the url
+	// objects use
+	mispURLTemplateUUID    = "60efb77b-40b5-4c46-871b-ed1ed999fce5"
+	mispURLTemplateVersion = "9"
+)
+
+// mispIOCType maps an indicator type to a MISP attribute type, category,
+// IDS flag and comment
+func mispIOCType(iocType string) (string, string, bool, string) {
+	switch iocType {
+	case IOCBitcoin:
+		return "btc", "Financial fraud", true, ""
+	case IOCMonero:
+		return "xmr", "Financial fraud", true, ""
+	case IOCEthereum:
+		return "text", "Financial fraud", false, "Ethereum address"
+	case IOCEmail:
+		return "email-src", "Payload delivery", false, ""
+	case IOCPGPKey:
+		return "pgp-public-key", "Person", false, ""
+	case IOCPGPFingerprint:
+		return "text", "Person", false, "PGP fingerprint"
+	case IOCJabber:
+		return "jabber-id", "Social network", false, ""
+	case IOCTelegram:
+		return "text", "Social network", false, "Telegram handle"
+	case IOCTox:
+		return "text", "Social network", false, "Tox ID"
+	case IOCDomain:
+		return "domain", "Network activity", true, ""
+	case IOCIPv4, IOCIPv6:
+		return "ip-dst", "Network activity", true, ""
+	case IOCMD5, IOCSHA1, IOCSHA256:
+		return iocType, "Payload delivery", true, ""
+	}
+	return "text", "Other", false, iocType
+}
+
+// mispTypeTag returns the tag derived from a target type
+func mispTypeTag(targetType string) MISPTag {
+	return MISPTag{Name: "tor-scraper:type=\"" + targetType + "\""}
+}
+
+// buildMISPEvent converts a scan report into a MISP event with one url object
+// per scanned URL and an attribute per extracted indicator. UUIDs derive from
+// the scan's start time and the values, so importing a re-export of the same
+// report updates the existing event instead of creating a new one.
+func buildMISPEvent(report ScanReport, options MISPOptions) MISPEvent {
+	eventUUID := uuidV5(scraperNamespace, "misp-event|"+report.StartTime.UTC().Format(time.RFC3339Nano))
+	timestamp := strconv.FormatInt(report.EndTime.Unix(), 10)
+
+	info := options.Info
+	if info == "" {
+		info = "Tor scraper scan " + report.StartTime.Format("2006-01-02 15:04")
+	}
+
+	event := MISPEvent{
+		UUID:          eventUUID,
+		Info:          info,
+		Date:          report.StartTime.Format("2006-01-02"),
+		Timestamp:     timestamp,
+		Distribution:  strconv.Itoa(options.Distribution),
+		ThreatLevelID: strconv.Itoa(options.ThreatLevelID),
+		Analysis:      strconv.Itoa(options.Analysis),
+		Attribute:     []MISPAttribute{},
+		Object:        []MISPObject{},
+	}
+
+	attribute := func(relation, attrType, category, value string, toIDs bool) MISPAttribute {
+		return MISPAttribute{
+			UUID:           uuidV5(scraperNamespace, "misp-attribute|"+eventUUID+"|"+relation+"|"+attrType+"|"+value),
+			Type:           attrType,
+			Category:       category,
+			Value:          value,
+			ToIDs:          toIDs,
+			Distribution:   mispInheritDistribution,
+			Timestamp:      timestamp,
+			ObjectRelation: relation,
+		}
+	}
+
+	typeTags := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, result := range report.Results {
+		pageURL := resultKey(result)
+		if seen[pageURL] {
+			continue
+		}
+		seen[pageURL] = true
+
+		urlAttribute := attribute("url", "url", "Network activity", pageURL, false)
+		if result.Type != "" {
+			urlAttribute.Tag = []MISPTag{mispTypeTag(result.Type)}
+			if !typeTags[result.Type] {
+				typeTags[result.Type] = true
+				event.Tag = append(event.Tag, mispTypeTag(result.Type))
+			}
+		}
+		attributes := []MISPAttribute{urlAttribute}
+
+		if u, err := url.Parse(pageURL); err == nil && u.Hostname() != "" {
+			hostAttribute := attribute("host", "hostname", "Network activity", u.Hostname(), false)
+			if _, ok := onionServiceHost(u.Hostname()); ok {
+				hostAttribute.Comment = "Onion service"
+			}
+			attributes = append(attributes, hostAttribute)
+		}
+		status := result.Status
+		if result.StatusCode > 0 {
+			status += fmt.Sprintf(" (HTTP %d)", result.StatusCode)
+		}
+		statusAttribute := attribute("text", "text", "Other", status, false)
+		statusAttribute.Comment = "Status"
+		attributes = append(attributes, statusAttribute)
+		attributes = append(attributes, attribute("first-seen", "datetime", "Other", result.Timestamp.UTC().Format(time.RFC3339), false))
+
+		// The url template has no title relation, so the title goes in the comment
+		comment := result.Name
+		if result.Title != "" {
+			if comment != "" {
+				comment += "; "
+			}
+			comment += "Page title: " + result.Title
+		}
+
+		event.Object = append(event.Object, MISPObject{
+			UUID:            uuidV5(scraperNamespace, "misp-object|"+eventUUID+"|"+pageURL),
+			Name:            "url",
+			MetaCategory:    "network",
+			Description:     "Scanned target",
+			TemplateUUID:    mispURLTemplateUUID,
+			TemplateVersion: mispURLTemplateVersion,
+			Distribution:    mispInheritDistribution,
+			Timestamp:       timestamp,
+			Comment:         comment,
+			Attribute:       attributes,
+		})
+	}
+
+	for _, ioc := range report.IOCs {
+		attrType, category, toIDs, comment := mispIOCType(ioc.Type)
+		indicator := attribute("", attrType, category, ioc.Value, toIDs)
+		indicator.Comment = comment
+		event.Attribute = append(event.Attribute, indicator)
+	}
+
+	return event
+}
+
+// writeMISPEvent saves a scan report as a MISP event JSON file
+func writeMISPEvent(report ScanReport, options MISPOptions, path string) error {
+	data, err := json.MarshalIndent(struct {
+		Event MISPEvent `json:"Event"`
+	}{buildMISPEvent(report, options)}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal MISP event: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write MISP event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildMISPEvent(t *testing.T) {
+	report := loadFixtureReport(t)
+	event := buildMISPEvent(report, MISPOptions{Distribution: 0, ThreatLevelID: 4, Analysis: 2})
+
+	if len(event.Object) != 3 {
+		t.Fatalf("got %d objects, want one per scanned URL", len(event.Object))
+	}
+	values := make(map[string]MISPAttribute)
+	for _, object := range event.Object {
+		for _, attribute := range object.Attribute {
+			values[attribute.ObjectRelation+" "+attribute.Value] = attribute
+		}
+	}
+	for _, want := range []string{"url http://abc.onion/", "host abc.onion", "host market.example.onion"} {
+		if _, ok := values[want]; !ok {
+			t.Errorf("event has no %s attribute", want)
+		}
+	}
+
+	// Objects must only use relations of the MISP url object template
+	urlRelations := map[string]bool{"url": true, "host": true, "text": true, "first-seen": true}
+	titled := false
+	for _, object := range event.Object {
+		if object.TemplateUUID != mispURLTemplateUUID || object.TemplateVersion == "" {
+			t.Errorf("object %s has template %q version %q", object.UUID, object.TemplateUUID, object.TemplateVersion)
+		}
+		for _, attribute := range object.Attribute {
+			if !urlRelations[attribute.ObjectRelation] {
+				t.Errorf("object %s uses relation %q, which the url template does not define", object.UUID, attribute.ObjectRelation)
+			}
+		}
+		titled = titled || strings.Contains(object.Comment, `Page title: Forum "index"`)
+	}
+	if !titled {
+		t.Errorf("no object comment carries the page title")
+	}
+	if _, ok := values["url abc.onion"]; ok {
+		t.Errorf("event has a url attribute without a scheme")
+	}
+	if host := values["host abc.onion"]; host.Type != "hostname" {
+		t.Errorf("host attribute = %+v, want a hostname", host)
+	}
+	if len(event.Tag) != 1 || event.Tag[0].Name != `tor-scraper:type="forum"` {
+		t.Errorf("event tags = %v, want the forum type tag", event.Tag)
+	}
+
+	types := make(map[string]string)
+	for _, attribute := range event.Attribute {
+		types[attribute.Value] = attribute.Type
+	}
+	if len(event.Attribute) != len(report.IOCs) {
+		t.Errorf("got %d indicator attributes, want %d", len(event.Attribute), len(report.IOCs))
+	}
+	for value, want := range map[string]string{
+		"1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa": "btc",
+		"admin@example.com":                  "email-src",
+		"2001:db8::1":                        "ip-dst",
+		"d41d8cd98f00b204e9800998ecf8427e":   "md5",
+	} {
+		if types[value] != want {
+			t.Errorf("attribute %s has type %q, want %q", value, types[value], want)
+		}
+	}
+
+	// UUIDs are derived from the report, so a re-export updates the same event
+	if again := buildMISPEvent(report, MISPOptions{Distribution: 0, ThreatLevelID: 4, Analysis: 2}); !reflect.DeepEqual(event, again) {
+		t.Errorf("exporting the same report twice produced different events")
+	}
+}
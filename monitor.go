@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// historyFileName is the check history kept in the output directory
+	historyFileName = "availability_history.jsonl"
+	// historyRetention is how long check records are kept
+	historyRetention = 30 * 24 * time.Hour
+	// sparklineChecks is the number of recent checks drawn per target
+	sparklineChecks = 48
+)
+
+// CheckRecord is a single availability check stored in the history file
+type CheckRecord struct {
+	URL        string    `json:"url"`
+	Name       string    `json:"name,omitempty"`
+	Up         bool      `json:"up"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code"`
+	LatencyMS  int64     `json:"latency_ms"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// TargetAvailability summarizes a target's check history
+type TargetAvailability struct {
+	URL          string        `json:"url"`
+	Name         string        `json:"name,omitempty"`
+	Up           bool          `json:"up"`
+	Transition   string        `json:"transition,omitempty"`
+	LastChange   *time.Time    `json:"last_change,omitempty"`
+	Uptime24h    float64       `json:"uptime_24h"`
+	Uptime7d     float64       `json:"uptime_7d"`
+	Uptime30d    float64       `json:"uptime_30d"`
+	Checks       int           `json:"checks"`
+	AvgLatencyMS int64         `json:"avg_latency_ms"`
+	Recent       []CheckRecord `json:"-"`
+}
+
+// isUp reports whether a scan result counts as the service being available.
+// A page gated by a queue or CAPTCHA is up, it just did not let us in.
+func isUp(result ScanResult) bool {
+	return (result.Status == "SUCCESS" || result.Status == "CHALLENGE") && result.StatusCode > 0 && result.StatusCode < 500
+}
+
+// resultKey returns the URL used to identify a result across runs
+func resultKey(result ScanResult) string {
+	if result.CanonicalURL != "" {
+		return result.CanonicalURL
+	}
+	return result.URL
+}
+
+// loadHistory reads all check records from the history file. A missing file
+// is an empty history.
+func loadHistory(path string) ([]CheckRecord, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	var records []CheckRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record CheckRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			fmt.Printf("[WARN] Skipping malformed history line: %v\n", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+	return records, nil
+}
+
+// saveHistory rewrites the history file, dropping records past the retention window
+func saveHistory(path string, records []CheckRecord, now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create history file: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, record := range records {
+		if now.Sub(record.Timestamp) > historyRetention {
+			continue
+		}
+		line, err := json.Marshal(record)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("failed to marshal history record: %w", err)
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write history file: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// recordChecks converts a report's results into check records
+func recordChecks(report ScanReport) []CheckRecord {
+	records := make([]CheckRecord, 0, len(report.Results))
+	for _, result := range report.Results {
+		records = append(records, CheckRecord{
+			URL:        resultKey(result),
+			Name:       result.Name,
+			Up:         isUp(result),
+			Status:     result.Status,
+			StatusCode: result.StatusCode,
+			LatencyMS:  result.LatencyMS,
+			Timestamp:  result.Timestamp,
+		})
+	}
+	return records
+}
+
+// computeAvailability builds per-target uptime statistics for the URLs in the
+// current report from the full history (which must include the current checks)
+func computeAvailability(report ScanReport, history []CheckRecord, now time.Time) []TargetAvailability {
+	byURL := make(map[string][]CheckRecord)
+	for _, record := range history {
+		byURL[record.URL] = append(byURL[record.URL], record)
+	}
+
+	var availability []TargetAvailability
+	for _, result := range report.Results {
+		key := resultKey(result)
+		records := byURL[key]
+		stats := TargetAvailability{
+			URL:       key,
+			Name:      result.Name,
+			Up:        isUp(result),
+			Uptime24h: uptimePercent(records, now, 24*time.Hour),
+			Uptime7d:  uptimePercent(records, now, 7*24*time.Hour),
+			Uptime30d: uptimePercent(records, now, 30*24*time.Hour),
+			Checks:    len(records),
+		}
+
+		var totalLatency int64
+		var latencyCount int64
+		for i, record := range records {
+			if record.Up {
+				totalLatency += record.LatencyMS
+				latencyCount++
+			}
+			if i > 0 && record.Up != records[i-1].Up {
+				changed := record.Timestamp
+				stats.LastChange = &changed
+			}
+		}
+		if latencyCount > 0 {
+			stats.AvgLatencyMS = totalLatency / latencyCount
+		}
+
+		// The last record is the current check; compare it with the one before
+		if n := len(records); n >= 2 && records[n-1].Up != records[n-2].Up {
+			stats.Transition = upDown(records[n-2].Up) + " -> " + upDown(records[n-1].Up)
+		}
+
+		if len(records) > sparklineChecks {
+			records = records[len(records)-sparklineChecks:]
+		}
+		stats.Recent = records
+		availability = append(availability, stats)
+	}
+	return availability
+}
+
+// uptimePercent returns the share of successful checks within the window
+func uptimePercent(records []CheckRecord, now time.Time, window time.Duration) float64 {
+	total, up := 0, 0
+	for _, record := range records {
+		if now.Sub(record.Timestamp) > window {
+			continue
+		}
+		total++
+		if record.Up {
+			up++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(up) / float64(total) * 100
+}
+
+// upDown formats an availability state
+func upDown(up bool) string {
+	if up {
+		return "UP"
+	}
+	return "DOWN"
+}
+
+// generateSparkline draws the recent checks as an inline SVG bar chart;
+// bar height follows latency and color follows availability
+func generateSparkline(records []CheckRecord) string {
+	const width, height, barWidth = 4 * sparklineChecks, 24, 4
+
+	var maxLatency int64 = 1
+	for _, record := range records {
+		if record.LatencyMS > maxLatency {
+			maxLatency = record.LatencyMS
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf(`<svg width="%d" height="%d" viewBox="0 0 %d %d">`, width, height, width, height))
+	for i, record := range records {
+		barHeight := height
+		color := "#e74c3c"
+		if record.Up {
+			color = "#27ae60"
+			barHeight = 4 + int(float64(height-4)*float64(record.LatencyMS)/float64(maxLatency))
+		}
+		sb.WriteString(fmt.Sprintf(`<rect x="%d" y="%d" width="%d" height="%d" fill="%s"><title>%s</title></rect>`,
+			i*barWidth, height-barHeight, barWidth-1, barHeight, color,
+			html.EscapeString(fmt.Sprintf("%s %s %dms", record.Timestamp.Format("2006-01-02 15:04"), upDown(record.Up), record.LatencyMS))))
+	}
+	sb.WriteString(`</svg>`)
+	return sb.String()
+}
+
+// generateAvailabilitySection renders the availability table for the HTML report
+func generateAvailabilitySection(availability []TargetAvailability) string {
+	if len(availability) == 0 {
+		return ""
+	}
+
+	section := `
+
+            <h2>📈 Availability</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>Target</th>
+                        <th>State</th>
+                        <th>24h</th>
+                        <th>7d</th>
+                        <th>30d</th>
+                        <th>Avg Latency</th>
+                        <th>History</th>
+                    </tr>
+                </thead>
+                <tbody>`
+
+	for _, stats := range availability {
+		label := html.EscapeString(stats.URL)
+		if stats.Name != "" {
+			label = "<strong>" + html.EscapeString(stats.Name) + "</strong><br>" + label
+		}
+		stateClass := "status-success"
+		if !stats.Up {
+			stateClass = "status-failed"
+		}
+		state := upDown(stats.Up)
+		if stats.Transition != "" {
+			state += " (changed)"
+		}
+
+		section += fmt.Sprintf(`
+                    <tr>
+                        <td>%s</td>
+                        <td class="%s">%s</td>
+                        <td>%.1f%%</td>
+                        <td>%.1f%%</td>
+                        <td>%.1f%%</td>
+                        <td>%d ms</td>
+                        <td>%s</td>
+                    </tr>`,
+			label, stateClass, state, stats.Uptime24h, stats.Uptime7d, stats.Uptime30d,
+			stats.AvgLatencyMS, generateSparkline(stats.Recent))
+	}
+
+	section += `
+                </tbody>
+            </table>`
+	return section
+}
+
+// runMonitor checks targets at a fixed interval, records every check in the
+// history file and reports uptime and up/down transitions
+func runMonitor(args []string) error {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	interval := fs.Duration("interval", 10*time.Minute, "time between checks")
+	once := fs.Bool("once", false, "run a single check and exit")
+	flags := addScanFlags(fs)
+	fs.Usage = func() {
+		fmt.Println("Usage: tor-scraper monitor [flags] <targets_file> [output_directory]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing targets file")
+	}
+	targetsFile := fs.Arg(0)
+	outputDir := "output"
+	if fs.NArg() > 1 {
+		outputDir = fs.Arg(1)
+	}
+	if *interval < time.Minute {
+		return fmt.Errorf("interval %v is shorter than one minute", *interval)
+	}
+	if err := flags.validate(); err != nil {
+		return err
+	}
+
+	fmt.Println("========================================")
+	fmt.Println("   Tor Scraper - Uptime Monitor")
+	fmt.Println("========================================")
+	fmt.Println()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+
+	for {
+		if err := runMonitorCheck(targetsFile, flags, outputDir); err != nil {
+			if *once {
+				return err
+			}
+			// A -fail-on hit was already alerted; only a single check exits with it
+			if !errors.Is(err, errFailOn) {
+				fmt.Printf("[ERR] Monitor check failed: %v\n", err)
+			}
+		}
+		if *once {
+			return nil
+		}
+
+		fmt.Printf("[INFO] Next check at %s\n", time.Now().Add(*interval).Format("2006-01-02 15:04:05"))
+		select {
+		case sig := <-stop:
+			fmt.Printf("[INFO] Received %v, stopping monitor\n", sig)
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+// runMonitorCheck performs one round of checks, updates the history and
+// writes the report with its availability section
+func runMonitorCheck(targetsFile string, flags *scanFlags, outputDir string) error {
+	config, duplicates, options, err := loadScanConfig(targetsFile, flags)
+	if err != nil {
+		return err
+	}
+
+	client, err := createTorClient(options.Client)
+	if err != nil {
+		return fmt.Errorf("failed to create Tor client: %w", err)
+	}
+
+	scan := func(client *http.Client) ScanReport { return runScan(client, config.Targets) }
+	report := runPipeline(client, options, duplicates, scan, loadPreviousReport(filepath.Join(outputDir, "scan_report.json")), true)
+
+	historyPath := filepath.Join(outputDir, historyFileName)
+	history, err := loadHistory(historyPath)
+	if err != nil {
+		return err
+	}
+	history = append(history, recordChecks(report)...)
+	if err := saveHistory(historyPath, history, report.EndTime); err != nil {
+		return err
+	}
+
+	report.Availability = computeAvailability(report, history, report.EndTime)
+	for _, stats := range report.Availability {
+		if stats.Transition != "" {
+			fmt.Printf("[ALERT] %s changed state: %s\n", stats.URL, stats.Transition)
+		}
+	}
+
+	if err := saveRun(report, outputDir, outputDir); err != nil {
+		return err
+	}
+	if flags.checkFailOn(report) {
+		return errFailOn
+	}
+	return nil
+}
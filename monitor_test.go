@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUptimePercent(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	records := []CheckRecord{
+		{Up: false, Timestamp: now.Add(-20 * 24 * time.Hour)},
+		{Up: true, Timestamp: now.Add(-3 * 24 * time.Hour)},
+		{Up: false, Timestamp: now.Add(-2 * time.Hour)},
+		{Up: true, Timestamp: now.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		name   string
+		window time.Duration
+		want   float64
+	}{
+		{"24h", 24 * time.Hour, 50},
+		{"7d", 7 * 24 * time.Hour, 200.0 / 3},
+		{"30d", 30 * 24 * time.Hour, 50},
+		{"empty window", time.Minute, 0},
+	}
+	for _, tt := range tests {
+		if got := uptimePercent(records, now, tt.window); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: uptimePercent() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestComputeAvailability(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	check := func(url string, up bool, ago time.Duration, latency int64) CheckRecord {
+		return CheckRecord{URL: url, Up: up, LatencyMS: latency, Timestamp: now.Add(-ago)}
+	}
+
+	tests := []struct {
+		name       string
+		history    []CheckRecord
+		result     ScanResult
+		transition string
+		changed    bool
+		latency    int64
+	}{
+		{
+			name:    "first check",
+			history: []CheckRecord{check("http://a.onion/", true, 0, 300)},
+			result:  ScanResult{URL: "http://a.onion/", Status: "SUCCESS", StatusCode: 200},
+			latency: 300,
+		},
+		{
+			name: "went down",
+			history: []CheckRecord{
+				check("http://a.onion/", true, 2*time.Hour, 100),
+				check("http://a.onion/", true, time.Hour, 300),
+				check("http://a.onion/", false, 0, 0),
+			},
+			result:     ScanResult{URL: "http://a.onion/", Status: "FAILED"},
+			transition: "UP -> DOWN",
+			changed:    true,
+			latency:    200,
+		},
+		{
+			name: "came back",
+			history: []CheckRecord{
+				check("http://a.onion/", false, time.Hour, 0),
+				check("http://a.onion/", true, 0, 500),
+			},
+			result:     ScanResult{URL: "http://a.onion/", Status: "SUCCESS", StatusCode: 200},
+			transition: "DOWN -> UP",
+			changed:    true,
+			latency:    500,
+		},
+		{
+			name: "changed earlier, steady now",
+			history: []CheckRecord{
+				check("http://a.onion/", false, 2*time.Hour, 0),
+				check("http://a.onion/", true, time.Hour, 100),
+				check("http://a.onion/", true, 0, 100),
+				check("http://b.onion/", false, 0, 0),
+			},
+			result:  ScanResult{URL: "http://a.onion/", Status: "SUCCESS", StatusCode: 200},
+			changed: true,
+			latency: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := ScanReport{Results: []ScanResult{tt.result}}
+			stats := computeAvailability(report, tt.history, now)
+			if len(stats) != 1 {
+				t.Fatalf("got %d targets, want 1", len(stats))
+			}
+			got := stats[0]
+			if got.Transition != tt.transition {
+				t.Errorf("transition = %q, want %q", got.Transition, tt.transition)
+			}
+			if (got.LastChange != nil) != tt.changed {
+				t.Errorf("last change = %v, want set: %v", got.LastChange, tt.changed)
+			}
+			if got.AvgLatencyMS != tt.latency {
+				t.Errorf("average latency = %d, want %d", got.AvgLatencyMS, tt.latency)
+			}
+			if got.Up != isUp(tt.result) {
+				t.Errorf("up = %v, want %v", got.Up, isUp(tt.result))
+			}
+		})
+	}
+}
+
+func TestComputeAvailabilityWindows(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	history := []CheckRecord{
+		{URL: "http://a.onion/", Up: false, Timestamp: now.Add(-10 * 24 * time.Hour)},
+		{URL: "http://a.onion/", Up: false, Timestamp: now.Add(-2 * 24 * time.Hour)},
+		{URL: "http://a.onion/", Up: true, Timestamp: now},
+	}
+	report := ScanReport{Results: []ScanResult{{URL: "http://a.onion/", Status: "SUCCESS", StatusCode: 200}}}
+	stats := computeAvailability(report, history, now)[0]
+	if stats.Uptime24h != 100 || stats.Uptime7d != 50 || math.Abs(stats.Uptime30d-100.0/3) > 1e-9 {
+		t.Errorf("uptime = %v/%v/%v, want 100/50/33.3", stats.Uptime24h, stats.Uptime7d, stats.Uptime30d)
+	}
+	if stats.Checks != 3 {
+		t.Errorf("checks = %d, want 3", stats.Checks)
+	}
+}
+
+func TestIsUp(t *testing.T) {
+	tests := []struct {
+		result ScanResult
+		want   bool
+	}{
+		{ScanResult{Status: "SUCCESS", StatusCode: 200}, true},
+		{ScanResult{Status: "SUCCESS", StatusCode: 404}, true},
+		{ScanResult{Status: "SUCCESS", StatusCode: 503}, false},
+		{ScanResult{Status: "CHALLENGE", StatusCode: 200}, true},
+		{ScanResult{Status: "FAILED"}, false},
+		{ScanResult{Status: "BLOCKED"}, false},
+	}
+	for _, tt := range tests {
+		if got := isUp(tt.result); got != tt.want {
+			t.Errorf("isUp(%s %d) = %v, want %v", tt.result.Status, tt.result.StatusCode, got, tt.want)
+		}
+	}
+}
+
+func TestSaveHistoryPrunesOldRecords(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), historyFileName)
+	records := []CheckRecord{
+		{URL: "http://a.onion/", Up: true, Timestamp: now.Add(-31 * 24 * time.Hour)},
+		{URL: "http://a.onion/", Up: true, Timestamp: now.Add(-29 * 24 * time.Hour)},
+		{URL: "http://a.onion/", Up: false, Timestamp: now},
+	}
+	if err := saveHistory(path, records, now); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 {
+		t.Fatalf("loaded %d records, want the 2 within 30 days", len(loaded))
+	}
+	if !loaded[0].Timestamp.Equal(records[1].Timestamp) || loaded[1].Up {
+		t.Errorf("loaded = %+v, want the last two records in order", loaded)
+	}
+
+	missing, err := loadHistory(filepath.Join(t.TempDir(), "none.jsonl"))
+	if err != nil || missing != nil {
+		t.Errorf("loadHistory(missing) = %v, %v, want an empty history", missing, err)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DuplicateTarget records a target that was merged into an earlier entry
+// because both resolve to the same canonical URL
+type DuplicateTarget struct {
+	URL          string `json:"url"`
+	CanonicalURL string `json:"canonical_url"`
+	MergedInto   string `json:"merged_into"`
+}
+
+// normalizeURL returns the canonical form of a target URL: scheme and host
+// are lowercased, default ports and fragments are dropped, dot segments and
+// trailing slashes are removed from the path and query parameters are sorted
+func normalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("empty URL")
+	}
+
+	// Ensure URL has a scheme so the host is parsed correctly
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", fmt.Errorf("missing host in %q", raw)
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+
+	// Clean the path; the root path is always "/" and others lose their trailing slash
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+	p = path.Clean(p)
+	unescaped, err := url.PathUnescape(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid path in %q: %w", raw, err)
+	}
+	u.Path = unescaped
+	u.RawPath = p
+
+	if query, err := url.ParseQuery(u.RawQuery); err == nil {
+		u.RawQuery = query.Encode()
+	}
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.User = nil
+
+	return u.String(), nil
+}
+
+// requestURL returns the URL a target is fetched from: the URL as written,
+// with http:// added when it has no scheme. The canonical URL only identifies
+// the target, since fetching it may request a different resource.
+func requestURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if !strings.HasPrefix(raw, "http://") && !strings.HasPrefix(raw, "https://") {
+		raw = "http://" + raw
+	}
+	return raw
+}
+
+// servedURL returns the URL a result's page was served from, which relative
+// links on it resolve against
+func servedURL(result ScanResult) string {
+	if result.FinalURL != "" {
+		return result.FinalURL
+	}
+	return requestURL(result.URL)
+}
+
+// dedupeTargets removes targets that share a canonical URL, keeping the first
+// entry and filling its empty fields from the merged duplicates
+func dedupeTargets(targets []Target) ([]Target, []DuplicateTarget) {
+	var unique []Target
+	var duplicates []DuplicateTarget
+	seen := make(map[string]int)
+
+	for _, target := range targets {
+		key := target.CanonicalURL
+		if key == "" {
+			key = target.URL
+		}
+
+		idx, exists := seen[key]
+		if !exists {
+			seen[key] = len(unique)
+			unique = append(unique, target)
+			continue
+		}
+
+		kept := &unique[idx]
+		if kept.Name == "" {
+			kept.Name = target.Name
+		}
+		if kept.Type == "" {
+			kept.Type = target.Type
+		}
+		if kept.MockResponse == "" {
+			kept.MockResponse = target.MockResponse
+		}
+		if kept.Crawl == nil {
+			kept.Crawl = target.Crawl
+		}
+		if kept.Session == "" {
+			kept.Session = target.Session
+		}
+		// The first copy's rate limit fields win, the duplicate fills the rest
+		if target.RateLimit != nil {
+			merged := target.RateLimit.merge(kept.RateLimit)
+			kept.RateLimit = &merged
+		}
+		for _, tag := range target.Tags {
+			if !containsString(kept.Tags, tag) {
+				kept.Tags = append(kept.Tags, tag)
+			}
+		}
+		for _, pin := range target.TLSPins {
+			if !containsString(kept.TLSPins, pin) {
+				kept.TLSPins = append(kept.TLSPins, pin)
+			}
+		}
+		duplicates = append(duplicates, DuplicateTarget{
+			URL:          target.URL,
+			CanonicalURL: key,
+			MergedInto:   kept.URL,
+		})
+	}
+
+	return unique, duplicates
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+	"gopkg.in/yaml.v3"
+)
+
+// onionHostPattern matches v2 (16 character) and v3 (56 character) onion
+// hostnames, including subdomains, anywhere in a page
+var onionHostPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9-]+\.)*([a-z2-7]{56}|[a-z2-7]{16})\.onion\b`)
+
+// onionEncoding is the lowercase, unpadded base32 alphabet used by onion addresses
+var onionEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// DiscoveredOnion is an onion service found on a fetched page that is not
+// yet a target. The YAML form can be read back with readTargets.
+type DiscoveredOnion struct {
+	URL        string `json:"url" yaml:"url"`
+	Name       string `json:"name,omitempty" yaml:"name,omitempty"`
+	Type       string `json:"type" yaml:"type"`
+	Version    int    `json:"version" yaml:"version"`
+	SourceURL  string `json:"source_url" yaml:"source_url"`
+	AnchorText string `json:"anchor_text,omitempty" yaml:"anchor_text,omitempty"`
+	SeenOn     int    `json:"seen_on" yaml:"seen_on"`
+}
+
+// validOnionHost reports the onion service version of a hostname (without
+// the .onion suffix), or 0 when it is not a valid address. v3 addresses
+// are checked against their embedded checksum; v2 addresses carry none, so
+// only their format can be checked.
+func validOnionHost(host string) int {
+	host = strings.ToLower(host)
+	switch len(host) {
+	case 16:
+		if _, err := onionEncoding.DecodeString(host); err != nil {
+			return 0
+		}
+		return 2
+	case 56:
+		raw, err := onionEncoding.DecodeString(host)
+		if err != nil || len(raw) != 35 {
+			return 0
+		}
+		pubkey, checksum, version := raw[:32], raw[32:34], raw[34]
+		if version != 3 {
+			return 0
+		}
+		// CHECKSUM = SHA3-256(".onion checksum" | PUBKEY | VERSION)[:2]
+		h := sha3.New256()
+		h.Write([]byte(".onion checksum"))
+		h.Write(pubkey)
+		h.Write([]byte{version})
+		if !bytes.Equal(h.Sum(nil)[:2], checksum) {
+			return 0
+		}
+		return 3
+	}
+	return 0
+}
+
+// onionServiceHost returns the service address of an onion hostname,
+// dropping any subdomains, and whether it is one
+func onionServiceHost(hostname string) (string, bool) {
+	match := onionHostPattern.FindStringSubmatch(hostname)
+	if match == nil {
+		return "", false
+	}
+	return strings.ToLower(match[1]) + ".onion", true
+}
+
+// discoverOnions collects valid onion addresses linked or mentioned on the
+// fetched pages that are not already targets or scanned hosts
+func discoverOnions(results []ScanResult, targets []Target) []DiscoveredOnion {
+	known := make(map[string]bool)
+	addKnown := func(rawURL string) {
+		if u, err := url.Parse(rawURL); err == nil {
+			if host, ok := onionServiceHost(u.Hostname()); ok {
+				known[host] = true
+			}
+		}
+	}
+	for _, target := range targets {
+		addKnown(target.CanonicalURL)
+	}
+	for _, result := range results {
+		addKnown(resultKey(result))
+	}
+
+	found := make(map[string]*DiscoveredOnion)
+	var order []string
+	add := func(service, source, anchor string) {
+		if known[service] {
+			return
+		}
+		if existing, ok := found[service]; ok {
+			existing.SeenOn++
+			if existing.AnchorText == "" && anchor != "" {
+				existing.AnchorText = anchor
+				existing.Name = anchor
+			}
+			return
+		}
+		version := validOnionHost(strings.TrimSuffix(service, ".onion"))
+		if version == 0 {
+			return
+		}
+		found[service] = &DiscoveredOnion{
+			URL:        "http://" + service + "/",
+			Name:       anchor,
+			Type:       "discovered",
+			Version:    version,
+			SourceURL:  source,
+			AnchorText: anchor,
+			SeenOn:     1,
+		}
+		order = append(order, service)
+	}
+
+	for _, result := range results {
+		if !hasContent(result) {
+			continue
+		}
+		source := resultKey(result)
+		onPage := make(map[string]bool)
+
+		// Links first, so the anchor text is kept where there is one
+		if isHTMLContent(result.ContentType) {
+			for _, link := range extractLinks(source, result.Content) {
+				u, err := url.Parse(link.URL)
+				if err != nil {
+					continue
+				}
+				if service, ok := onionServiceHost(u.Hostname()); ok && !onPage[service] {
+					onPage[service] = true
+					add(service, source, link.Text)
+				}
+			}
+		}
+		for _, match := range onionHostPattern.FindAllStringSubmatch(result.Content, -1) {
+			service := strings.ToLower(match[1]) + ".onion"
+			if !onPage[service] {
+				onPage[service] = true
+				add(service, source, "")
+			}
+		}
+	}
+
+	discovered := make([]DiscoveredOnion, 0, len(order))
+	for _, service := range order {
+		discovered = append(discovered, *found[service])
+	}
+	sort.SliceStable(discovered, func(i, j int) bool { return discovered[i].SeenOn > discovered[j].SeenOn })
+	return discovered
+}
+
+// writeDiscoveredOnions saves the discovered onions in the targets file
+// format so they can be scanned directly
+func writeDiscoveredOnions(discovered []DiscoveredOnion, path string) error {
+	data, err := yaml.Marshal(struct {
+		Targets []DiscoveredOnion `yaml:"targets"`
+	}{discovered})
+	if err != nil {
+		return fmt.Errorf("failed to marshal discovered onions: %w", err)
+	}
+
+	header := "# Onion services discovered on scanned pages\n# Scan them with: tor-scraper " + path + "\n"
+	if err := os.WriteFile(path, append([]byte(header), data...), 0644); err != nil {
+		return fmt.Errorf("failed to write discovered onions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+const (
+	testOnionV3 = "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad"
+	testOnionV2 = "expyuzz4wqqyqhjn"
+)
+
+func TestValidOnionHost(t *testing.T) {
+	tests := []struct {
+		host string
+		want int
+	}{
+		{testOnionV3, 3},
+		{"DuckDuckGoGG42XJOC72X3SJASOWOARFBGCMVFIMAFTT6TWAGSWZCZAD", 3},
+		{"2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid", 3},
+		// One character changed, so the checksum no longer matches
+		{"duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczbd", 0},
+		{"euckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad", 0},
+		{testOnionV2, 2},
+		{"expyuzz4wqqyqhj1", 0},
+		{"duckduckgo", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := validOnionHost(tt.host); got != tt.want {
+			t.Errorf("validOnionHost(%q) = %d, want %d", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestOnionServiceHost(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+		ok       bool
+	}{
+		{testOnionV3 + ".onion", testOnionV3 + ".onion", true},
+		{"www.forum." + testOnionV3 + ".onion", testOnionV3 + ".onion", true},
+		{"EXPYUZZ4WQQYQHJN.onion", testOnionV2 + ".onion", true},
+		{"abc.onion", "", false},
+		{"example.com", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := onionServiceHost(tt.hostname)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("onionServiceHost(%q) = %q, %v, want %q, %v", tt.hostname, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDiscoverOnions(t *testing.T) {
+	known := "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion"
+	page := func(url, content string) ScanResult {
+		return ScanResult{URL: url, Status: "SUCCESS", StatusCode: 200, ContentType: "text/html", Content: content}
+	}
+	results := []ScanResult{
+		page("http://"+known+"/links", `<a href="http://`+testOnionV3+`.onion/">DuckDuckGo</a>
+<a href="http://`+known+`/about">us</a>
+mirror: `+testOnionV3+`.onion
+old: `+testOnionV2+`.onion
+bad: duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczbd.onion`),
+		page("http://"+known+"/more", `see www.`+testOnionV3+`.onion`),
+	}
+	targets := []Target{withCanonicalURL(Target{URL: known})}
+
+	discovered := discoverOnions(results, targets)
+	if len(discovered) != 2 {
+		t.Fatalf("discovered %d onions, want 2: %+v", len(discovered), discovered)
+	}
+	first := discovered[0]
+	if first.URL != "http://"+testOnionV3+".onion/" || first.Version != 3 || first.SeenOn != 2 {
+		t.Errorf("first = %+v, want the v3 service seen on both pages", first)
+	}
+	if first.AnchorText != "DuckDuckGo" || first.Name != "DuckDuckGo" || first.SourceURL != "http://"+known+"/links" {
+		t.Errorf("first = %+v, want the link's anchor text and source page", first)
+	}
+	if discovered[1].Version != 2 || discovered[1].SeenOn != 1 {
+		t.Errorf("second = %+v, want the v2 service seen once", discovered[1])
+	}
+	for _, onion := range discovered {
+		if onion.URL == "http://"+known+"/" {
+			t.Errorf("discovered the existing target %s", known)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errFailOn is returned by commands whose run found watchlist matches at or
+// above the -fail-on severity; the process exits with code 2
+var errFailOn = errors.New("watchlist matches reached the -fail-on severity")
+
+// scanFlags are the flags shared by every command that scans targets. Flags
+// left unset keep the targets file's settings.
+type scanFlags struct {
+	watchlist        string
+	failOn           string
+	assets           bool
+	leaks            bool
+	tlsVerify        string
+	redirects        string
+	maxRedirects     int
+	clearnetAllow    string
+	profile          string
+	challengeRetries int
+}
+
+// addScanFlags registers the shared scan flags on fs
+func addScanFlags(fs *flag.FlagSet) *scanFlags {
+	f := &scanFlags{}
+	fs.StringVar(&f.watchlist, "watchlist", "", "watchlist file with keywords and regexes to alert on")
+	fs.StringVar(&f.failOn, "fail-on", "", "exit with code 2 when a watchlist match has at least this severity (e.g. high)")
+	fs.BoolVar(&f.assets, "assets", false, "fetch and hash favicons, icons, scripts and stylesheets")
+	fs.BoolVar(&f.leaks, "leaks", false, "probe onion hosts for pages and headers that leak their real location")
+	fs.StringVar(&f.tlsVerify, "tls-verify", "", "certificate verification: verify or skip-verify-onion (default from targets file, else verify)")
+	fs.StringVar(&f.redirects, "redirects", "", "redirect mode: follow-all, same-host-only, onion-only or none (default from targets file, else follow-all)")
+	fs.IntVar(&f.maxRedirects, "max-redirects", -1, "maximum redirects followed per request (default from targets file, else 10)")
+	fs.StringVar(&f.clearnetAllow, "clearnet-allow", "", "comma-separated clearnet hosts that may be contacted, added to clearnet_allow (\"*\" allows all)")
+	fs.StringVar(&f.profile, "profile", "", "request profile: tor-browser, firefox-esr or custom (default from targets file, else tor-browser)")
+	fs.IntVar(&f.challengeRetries, "challenge-retries", -1, "times a queue or interstitial page is waited out and refetched (default from targets file, else 0)")
+	return f
+}
+
+// validate checks the flag values that are not checked with the config
+func (f *scanFlags) validate() error {
+	if f.failOn != "" {
+		if _, ok := severityRanks[strings.ToLower(f.failOn)]; !ok {
+			return fmt.Errorf("unknown severity %q", f.failOn)
+		}
+	}
+	return nil
+}
+
+// apply overrides the config with the flags that were set
+func (f *scanFlags) apply(config *YAMLConfig) {
+	config.Assets = config.Assets || f.assets
+	config.LeakChecks = config.LeakChecks || f.leaks
+	if f.tlsVerify != "" {
+		config.TLSVerify = f.tlsVerify
+	}
+	if f.redirects != "" {
+		config.Redirects = f.redirects
+	}
+	if f.maxRedirects >= 0 {
+		maxRedirects := f.maxRedirects
+		config.MaxRedirects = &maxRedirects
+	}
+	if f.clearnetAllow != "" {
+		config.ClearnetAllow = append(config.ClearnetAllow, strings.Split(f.clearnetAllow, ",")...)
+	}
+	if f.profile != "" {
+		config.RequestProfile = f.profile
+	}
+	if f.challengeRetries >= 0 {
+		config.ChallengeRetries = f.challengeRetries
+	}
+}
+
+// checkFailOn reports whether the report has watchlist matches at or above
+// the -fail-on severity, logging an alert when it does
+func (f *scanFlags) checkFailOn(report ScanReport) bool {
+	if f.failOn == "" {
+		return false
+	}
+	count := countMatchesAtLeast(report, f.failOn)
+	if count == 0 {
+		return false
+	}
+	fmt.Printf("[ALERT] %d watchlist matches at or above %s severity\n", count, f.failOn)
+	return true
+}
+
+// loadScanConfig reads the targets file, applies the flags and loads the
+// analysis settings the config references
+func loadScanConfig(targetsFile string, flags *scanFlags) (*YAMLConfig, []DuplicateTarget, analysisOptions, error) {
+	config, duplicates, err := loadTargets(targetsFile)
+	if err != nil {
+		return nil, nil, analysisOptions{}, err
+	}
+	flags.apply(config)
+	options, err := newAnalysisOptions(config, targetsFile, flags.watchlist)
+	if err != nil {
+		return nil, nil, analysisOptions{}, err
+	}
+	return config, duplicates, options, nil
+}
+
+// runPipeline scans the targets with scan and runs the post-scan steps over
+// the report. The report is compared with previous when there is one;
+// includeRemoved is passed on to attachChanges.
+func runPipeline(client *http.Client, options analysisOptions, duplicates []DuplicateTarget, scan func(*http.Client) ScanReport, previous *ScanReport, includeRemoved bool) ScanReport {
+	openSessions(client, options)
+	report := scan(client)
+	handleChallenges(client, &report, options)
+	handleSessions(client, &report, options)
+	if options.FetchAssets {
+		fetchAssets(client, &report)
+	}
+	if options.LeakChecks {
+		runLeakChecks(client, &report)
+	}
+	report.Duplicates = duplicates
+	analyzeReport(&report, options)
+	if previous != nil {
+		attachChanges(&report, *previous, includeRemoved)
+	}
+	return report
+}
+
+// saveRun writes the report files to runDir and records the run in the
+// database in outputDir
+func saveRun(report ScanReport, outputDir, runDir string) error {
+	if err := saveScanReport(report, runDir); err != nil {
+		return fmt.Errorf("failed to save report: %w", err)
+	}
+	saveToDatabase(report, filepath.Join(outputDir, databaseFileName), runDir)
+	return nil
+}
+
+// exitWith ends the process after a failed command. Reaching the -fail-on
+// severity exits with code 2, which the alert was already logged for.
+func exitWith(err error) {
+	if errors.Is(err, errFailOn) {
+		os.Exit(2)
+	}
+	fmt.Printf("[ERR] %v\n", err)
+	os.Exit(1)
+}
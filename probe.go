@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// defaultProbePorts are tried on every onion host unless -ports is given
+	defaultProbePorts = "21,22,25,80,443,5222,6667,8080,8443"
+	// maxBannerSize bounds the bytes read from a service banner
+	maxBannerSize = 1024
+)
+
+// wellKnownServices names the service usually found on a port
+var wellKnownServices = map[int]string{
+	21: "ftp", 22: "ssh", 23: "telnet", 25: "smtp", 80: "http", 110: "pop3",
+	143: "imap", 443: "https", 465: "smtp", 587: "smtp", 993: "imap", 995: "pop3",
+	5222: "xmpp", 5269: "xmpp", 6667: "irc", 6697: "irc", 8080: "http", 8443: "https",
+}
+
+// PortResult is the outcome of probing one port of an onion host
+type PortResult struct {
+	Host      string    `json:"host"`
+	Name      string    `json:"name,omitempty"`
+	Port      int       `json:"port"`
+	Open      bool      `json:"open"`
+	Service   string    `json:"service,omitempty"`
+	Banner    string    `json:"banner,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Latency   int64     `json:"latency_ms"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ProbeReport holds the results of a port probe run
+type ProbeReport struct {
+	StartTime time.Time    `json:"start_time"`
+	EndTime   time.Time    `json:"end_time"`
+	Hosts     int          `json:"hosts"`
+	Ports     []int        `json:"ports"`
+	OpenPorts int          `json:"open_ports"`
+	Results   []PortResult `json:"results"`
+}
+
+// probeHost is an onion host taken from the targets file
+type probeHost struct {
+	host string
+	name string
+}
+
+// parsePorts parses a comma-separated port list
+func parsePorts(list string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", field)
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports given")
+	}
+	return ports, nil
+}
+
+// onionProbeHosts returns the distinct onion hosts among the targets
+func onionProbeHosts(targets []Target) []probeHost {
+	var hosts []probeHost
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		u, err := url.Parse(target.CanonicalURL)
+		if err != nil {
+			continue
+		}
+		host, ok := onionServiceHost(u.Hostname())
+		if !ok || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, probeHost{host: host, name: target.Name})
+	}
+	return hosts
+}
+
+// cleanBanner makes a banner printable, keeping line breaks
+func cleanBanner(data []byte) string {
+	banner := strings.Map(func(r rune) rune {
+		if r == '\n' || (unicode.IsPrint(r) && r != unicode.ReplacementChar) {
+			return r
+		}
+		return -1
+	}, string(data))
+	return strings.TrimSpace(banner)
+}
+
+// identifyService names the service behind a port from its banner, falling
+// back to the port's well-known service
+func identifyService(port int, banner string) string {
+	upper := strings.ToUpper(banner)
+	switch {
+	case strings.HasPrefix(banner, "SSH-"):
+		return "ssh"
+	case strings.HasPrefix(banner, "220"):
+		if strings.Contains(upper, "SMTP") || strings.Contains(upper, "MAIL") {
+			return "smtp"
+		}
+		if strings.Contains(upper, "FTP") {
+			return "ftp"
+		}
+	case strings.HasPrefix(banner, "+OK"):
+		return "pop3"
+	case strings.HasPrefix(banner, "* OK"):
+		return "imap"
+	case strings.HasPrefix(banner, ":") || strings.HasPrefix(upper, "NOTICE ") || strings.Contains(upper, "NOTICE AUTH"):
+		return "irc"
+	case strings.HasPrefix(banner, "<?xml") || strings.HasPrefix(banner, "<stream:"):
+		return "xmpp"
+	}
+	return wellKnownServices[port]
+}
+
+// probePort connects to one port through Tor and reads a banner if the
+// service sends one first
+func probePort(dialer proxy.ContextDialer, host probeHost, port int, timeout, bannerTimeout time.Duration) PortResult {
+	result := PortResult{Host: host.host, Name: host.name, Port: port, Timestamp: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host.host, strconv.Itoa(port)))
+	result.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer conn.Close()
+	result.Open = true
+
+	// Protocols such as HTTP wait for the client, so a timeout here is normal
+	conn.SetReadDeadline(time.Now().Add(bannerTimeout))
+	buf := make([]byte, maxBannerSize)
+	n, _ := conn.Read(buf)
+	result.Banner = cleanBanner(buf[:n])
+	result.Service = identifyService(port, result.Banner)
+	return result
+}
+
+// runProbe probes every port of every host with at most concurrency
+// connections open at once
+func runProbe(dialer proxy.ContextDialer, hosts []probeHost, ports []int, concurrency int, timeout, bannerTimeout time.Duration) ProbeReport {
+	report := ProbeReport{StartTime: time.Now(), Hosts: len(hosts), Ports: ports}
+	report.Results = make([]PortResult, len(hosts)*len(ports))
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, host := range hosts {
+		for j, port := range ports {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(index int, host probeHost, port int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				result := probePort(dialer, host, port, timeout, bannerTimeout)
+				if result.Open {
+					fmt.Printf("[INFO] %s:%d open (%s)\n", host.host, port, result.Service)
+				}
+				report.Results[index] = result
+			}(i*len(ports)+j, host, port)
+		}
+	}
+	wg.Wait()
+
+	for _, result := range report.Results {
+		if result.Open {
+			report.OpenPorts++
+		}
+	}
+	report.EndTime = time.Now()
+	return report
+}
+
+// saveProbeReport writes the probe results as JSON and CSV
+func saveProbeReport(report ProbeReport, outputDir string) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	jsonData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal probe report: %w", err)
+	}
+	jsonPath := filepath.Join(outputDir, "probe_report.json")
+	if err := os.WriteFile(jsonPath, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to write probe report: %w", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("Host,Name,Port,Open,Service,Latency_ms,Banner,Error\n")
+	for _, result := range report.Results {
+		sb.WriteString(fmt.Sprintf("%s,%s,%d,%t,%s,%d,%s,%s\n",
+			result.Host, csvQuote(result.Name), result.Port, result.Open, result.Service,
+			result.Latency, csvQuote(result.Banner), csvQuote(result.Error)))
+	}
+	csvPath := filepath.Join(outputDir, "probe_report.csv")
+	if err := os.WriteFile(csvPath, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write probe CSV: %w", err)
+	}
+
+	fmt.Printf("[INFO] Probe report saved to: %s\n", jsonPath)
+	fmt.Printf("[INFO] Probe CSV saved to: %s\n", csvPath)
+	return nil
+}
+
+// runProbeCommand implements the probe subcommand
+func runProbeCommand(args []string) error {
+	fs := flag.NewFlagSet("probe", flag.ExitOnError)
+	portList := fs.String("ports", defaultProbePorts, "comma-separated ports to try on each onion host")
+	concurrency := fs.Int("concurrency", 8, "maximum connections open at once")
+	timeout := fs.Duration("timeout", 60*time.Second, "connect timeout per port")
+	bannerTimeout := fs.Duration("banner-timeout", 10*time.Second, "how long to wait for a service banner")
+	fs.Usage = func() {
+		fmt.Println("Usage: tor-scraper probe [flags] <targets_file> [output_directory]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing targets file")
+	}
+	targetsFile := fs.Arg(0)
+	outputDir := "output"
+	if fs.NArg() > 1 {
+		outputDir = fs.Arg(1)
+	}
+
+	ports, err := parsePorts(*portList)
+	if err != nil {
+		return err
+	}
+	if *concurrency < 1 {
+		return fmt.Errorf("concurrency must be at least 1")
+	}
+
+	fmt.Println("========================================")
+	fmt.Println("   Tor Scraper - Port Probe")
+	fmt.Println("========================================")
+	fmt.Println()
+
+	config, _, err := loadTargets(targetsFile)
+	if err != nil {
+		return err
+	}
+	hosts := onionProbeHosts(config.Targets)
+	if len(hosts) == 0 {
+		return fmt.Errorf("no onion hosts in %s", targetsFile)
+	}
+
+	dialer, err := createTorDialer()
+	if err != nil {
+		return err
+	}
+	contextDialer, ok := dialer.(proxy.ContextDialer)
+	if !ok {
+		return fmt.Errorf("SOCKS5 dialer does not support timeouts")
+	}
+
+	fmt.Printf("[INFO] Probing %d ports on %d onion hosts\n", len(ports), len(hosts))
+	report := runProbe(contextDialer, hosts, ports, *concurrency, *timeout, *bannerTimeout)
+
+	sort.SliceStable(report.Results, func(i, j int) bool {
+		return report.Results[i].Open && !report.Results[j].Open
+	})
+	fmt.Printf("\n[INFO] Probe complete: %d open ports\n\n", report.OpenPorts)
+	for _, result := range report.Results {
+		if !result.Open {
+			continue
+		}
+		fmt.Printf("  %s:%d\t%s\t%s\n", result.Host, result.Port, result.Service,
+			strings.ReplaceAll(truncateUTF8(result.Banner, 80), "\n", " "))
+	}
+
+	return saveProbeReport(report, outputDir)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		list string
+		want []int
+	}{
+		{"80", []int{80}},
+		{"22, 80,443", []int{22, 80, 443}},
+		{"80,80,,443,", []int{80, 443}},
+		{defaultProbePorts, []int{21, 22, 25, 80, 443, 5222, 6667, 8080, 8443}},
+	}
+	for _, tt := range tests {
+		got, err := parsePorts(tt.list)
+		if err != nil {
+			t.Errorf("parsePorts(%q) error: %v", tt.list, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePorts(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+
+	for _, list := range []string{"", ",", "0", "65536", "-1", "http", "80-90"} {
+		if got, err := parsePorts(list); err == nil {
+			t.Errorf("parsePorts(%q) = %v, want error", list, got)
+		}
+	}
+}
+
+func TestIdentifyService(t *testing.T) {
+	tests := []struct {
+		port   int
+		banner string
+		want   string
+	}{
+		{2222, "SSH-2.0-OpenSSH_9.2p1 Debian-2", "ssh"},
+		{2525, "220 mail.example.onion ESMTP Postfix", "smtp"},
+		{2121, "220 (vsFTPd 3.0.3) FTP server ready", "ftp"},
+		{1100, "+OK Dovecot ready.", "pop3"},
+		{1143, "* OK [CAPABILITY IMAP4rev1] Dovecot ready.", "imap"},
+		{7000, ":irc.example.onion NOTICE * :*** Looking up your hostname...", "irc"},
+		{7001, "NOTICE AUTH :*** Processing connection", "irc"},
+		{5223, "<?xml version='1.0'?><stream:stream>", "xmpp"},
+		// An unrecognized banner or none falls back to the port
+		{21, "220 Welcome", "ftp"},
+		{80, "", "http"},
+		{6667, "", "irc"},
+		{12345, "hello", ""},
+	}
+	for _, tt := range tests {
+		if got := identifyService(tt.port, tt.banner); got != tt.want {
+			t.Errorf("identifyService(%d, %q) = %q, want %q", tt.port, tt.banner, got, tt.want)
+		}
+	}
+}
+
+func TestCleanBanner(t *testing.T) {
+	got := cleanBanner([]byte("  SSH-2.0-OpenSSH\r\n\x00\x01\xffhello\n"))
+	if want := "SSH-2.0-OpenSSH\nhello"; got != want {
+		t.Errorf("cleanBanner = %q, want %q", got, want)
+	}
+}
+
+func TestOnionProbeHosts(t *testing.T) {
+	const onion = "duckduckgogg42xjoc72x3sjasowoarfbgcmvfimaftt6twagswzczad.onion"
+	targets := []Target{
+		{CanonicalURL: "http://" + onion + "/", Name: "DuckDuckGo"},
+		{CanonicalURL: "http://www." + onion + "/about"},
+		{CanonicalURL: "https://example.com/"},
+		{CanonicalURL: "http://abc.onion/"},
+	}
+	want := []probeHost{{host: onion, name: "DuckDuckGo"}}
+	if got := onionProbeHosts(targets); !reflect.DeepEqual(got, want) {
+		t.Errorf("onionProbeHosts = %+v, want %+v", got, want)
+	}
+}
+
+// pipeDialer answers every dial with an in-memory connection whose far end
+// sends banners[port], or refuses ports without one
+type pipeDialer struct {
+	banners map[string]string
+}
+
+func (d pipeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	_, port, _ := net.SplitHostPort(addr)
+	banner, ok := d.banners[port]
+	if !ok {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: &net.AddrError{Err: "connection refused", Addr: addr}}
+	}
+	client, server := net.Pipe()
+	go func() {
+		if banner != "" {
+			server.Write([]byte(banner))
+		}
+		time.Sleep(200 * time.Millisecond)
+		server.Close()
+	}()
+	return client, nil
+}
+
+func TestRunProbe(t *testing.T) {
+	dialer := pipeDialer{banners: map[string]string{"22": "SSH-2.0-OpenSSH_9.2\r\n", "80": ""}}
+	hosts := []probeHost{{host: "a.onion"}, {host: "b.onion"}}
+	report := runProbe(dialer, hosts, []int{22, 80, 443}, 2, time.Second, 50*time.Millisecond)
+
+	if len(report.Results) != 6 || report.OpenPorts != 4 {
+		t.Fatalf("got %d results with %d open, want 6 with 4 open", len(report.Results), report.OpenPorts)
+	}
+	for _, result := range report.Results {
+		switch result.Port {
+		case 22:
+			if !result.Open || result.Service != "ssh" || result.Banner != "SSH-2.0-OpenSSH_9.2" {
+				t.Errorf("port 22 = %+v, want an open ssh port with its banner", result)
+			}
+		case 80:
+			if !result.Open || result.Service != "http" || result.Banner != "" {
+				t.Errorf("port 80 = %+v, want an open http port without a banner", result)
+			}
+		case 443:
+			if result.Open || result.Error == "" {
+				t.Errorf("port 443 = %+v, want a closed port with an error", result)
+			}
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Request profile names
+const (
+	ProfileTorBrowser = "tor-browser"
+	ProfileFirefoxESR = "firefox-esr"
+	ProfileCustom     = "custom"
+)
+
+// maxHeaderBlock bounds the request header bytes buffered for reordering
+const maxHeaderBlock = 64 * 1024
+
+// RequestProfile is the set of request headers, and their order, sent to
+// look like a particular browser
+type RequestProfile struct {
+	Name                    string `yaml:"-"`
+	UserAgent               string `yaml:"user_agent,omitempty"`
+	Accept                  string `yaml:"accept,omitempty"`
+	AcceptLanguage          string `yaml:"accept_language,omitempty"`
+	AcceptEncoding          string `yaml:"accept_encoding,omitempty"`
+	UpgradeInsecureRequests *bool  `yaml:"upgrade_insecure_requests,omitempty"`
+	// Headers are extra headers sent with every request
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// HeaderOrder lists header names in the order they are sent; headers not
+	// listed follow in Go's order
+	HeaderOrder []string `yaml:"header_order,omitempty"`
+}
+
+// firefoxHeaderOrder is the order Firefox 128 sends request headers in
+var firefoxHeaderOrder = []string{
+	"Host", "User-Agent", "Accept", "Accept-Language", "Accept-Encoding", "Content-Type",
+	"Content-Length", "Origin", "Referer", "Connection", "Cookie", "Upgrade-Insecure-Requests", "Sec-Fetch-Dest",
+	"Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User", "Priority",
+}
+
+// firefoxNavigationHeaders are the fetch metadata headers of a top-level
+// navigation. Connection is left to the transport, which sends "close".
+var firefoxNavigationHeaders = map[string]string{
+	"Sec-Fetch-Dest": "document",
+	"Sec-Fetch-Mode": "navigate",
+	"Sec-Fetch-Site": "none",
+	"Sec-Fetch-User": "?1",
+	"Priority":       "u=0, i",
+}
+
+// builtinProfiles are the selectable request profiles. Tor Browser reports
+// the same Windows user agent on every platform.
+var builtinProfiles = map[string]RequestProfile{
+	ProfileTorBrowser: {
+		UserAgent:      "Mozilla/5.0 (Windows NT 10.0; rv:128.0) Gecko/20100101 Firefox/128.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.5",
+		AcceptEncoding: "gzip, deflate, br, zstd",
+		Headers:        firefoxNavigationHeaders,
+		HeaderOrder:    firefoxHeaderOrder,
+	},
+	ProfileFirefoxESR: {
+		UserAgent:      "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0",
+		Accept:         "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		AcceptLanguage: "en-US,en;q=0.5",
+		AcceptEncoding: "gzip, deflate, br, zstd",
+		Headers:        firefoxNavigationHeaders,
+		HeaderOrder:    firefoxHeaderOrder,
+	},
+}
+
+// newRequestProfile selects the request profile named in the config. The
+// custom profile starts from Tor Browser and replaces the fields it sets.
+func newRequestProfile(config *YAMLConfig) (RequestProfile, error) {
+	name := config.RequestProfile
+	if name == "" {
+		name = ProfileTorBrowser
+	}
+	if name != ProfileCustom {
+		profile, ok := builtinProfiles[name]
+		if !ok {
+			return RequestProfile{}, fmt.Errorf("unknown request profile %q", name)
+		}
+		profile.Name = name
+		profile.UpgradeInsecureRequests = boolPtr(true)
+		return profile, nil
+	}
+
+	profile := builtinProfiles[ProfileTorBrowser]
+	profile.Name = ProfileCustom
+	profile.UpgradeInsecureRequests = boolPtr(true)
+	custom := config.CustomProfile
+	if custom == nil {
+		return profile, nil
+	}
+	if custom.UserAgent != "" {
+		profile.UserAgent = custom.UserAgent
+	}
+	if custom.Accept != "" {
+		profile.Accept = custom.Accept
+	}
+	if custom.AcceptLanguage != "" {
+		profile.AcceptLanguage = custom.AcceptLanguage
+	}
+	if custom.AcceptEncoding != "" {
+		for _, encoding := range strings.Split(custom.AcceptEncoding, ",") {
+			if name := strings.TrimSpace(strings.SplitN(encoding, ";", 2)[0]); !supportedEncoding(name) {
+				return profile, fmt.Errorf("custom profile: cannot decode content encoding %q", name)
+			}
+		}
+		profile.AcceptEncoding = custom.AcceptEncoding
+	}
+	if custom.UpgradeInsecureRequests != nil {
+		profile.UpgradeInsecureRequests = custom.UpgradeInsecureRequests
+	}
+	if custom.Headers != nil {
+		profile.Headers = custom.Headers
+	}
+	if custom.HeaderOrder != nil {
+		profile.HeaderOrder = custom.HeaderOrder
+	}
+	return profile, nil
+}
+
+// boolPtr returns a pointer to b
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// potentiallyTrustworthy reports whether Firefox treats a URL as a secure
+// context, the only ones it sends fetch metadata headers to. Tor Browser
+// treats onion services as secure.
+func potentiallyTrustworthy(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	return u.Scheme == "https" || strings.HasSuffix(host, ".onion") || host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+// apply sets the profile's headers on a request to u
+func (p RequestProfile) apply(header http.Header, u *url.URL) {
+	set := func(name, value string) {
+		if value != "" {
+			header.Set(name, value)
+		}
+	}
+	set("User-Agent", p.UserAgent)
+	set("Accept", p.Accept)
+	set("Accept-Language", p.AcceptLanguage)
+	set("Accept-Encoding", p.AcceptEncoding)
+	if p.UpgradeInsecureRequests != nil && *p.UpgradeInsecureRequests {
+		header.Set("Upgrade-Insecure-Requests", "1")
+	}
+	for name, value := range p.Headers {
+		canonical := http.CanonicalHeaderKey(name)
+		if strings.HasPrefix(canonical, "Sec-Fetch-") && !potentiallyTrustworthy(u) {
+			continue
+		}
+		// Keep-alives are disabled, so the transport writes "Connection: close"
+		// and a profile's Connection header would contradict it
+		if canonical == "Connection" {
+			continue
+		}
+		// Headers the request sets itself, such as a form post's Sec-Fetch-Site, win
+		if header.Get(name) != "" {
+			continue
+		}
+		header.Set(name, value)
+	}
+}
+
+// wrapConn reorders the request headers written to conn to the profile's
+// header order. Go always writes headers sorted by name, so reordering has
+// to happen on the wire.
+func (p RequestProfile) wrapConn(conn net.Conn) net.Conn {
+	if len(p.HeaderOrder) == 0 {
+		return conn
+	}
+	rank := make(map[string]int, len(p.HeaderOrder))
+	for i, name := range p.HeaderOrder {
+		rank[http.CanonicalHeaderKey(name)] = i
+	}
+	return &orderedConn{Conn: conn, rank: rank}
+}
+
+// orderedConn buffers the request header block and writes it out with the
+// header lines reordered. The client disables keep-alives, so each
+// connection carries a single request.
+type orderedConn struct {
+	net.Conn
+	rank map[string]int
+	buf  []byte
+	done bool
+}
+
+func (c *orderedConn) Write(p []byte) (int, error) {
+	if c.done {
+		return c.Conn.Write(p)
+	}
+	c.buf = append(c.buf, p...)
+	end := bytes.Index(c.buf, []byte("\r\n\r\n"))
+	if end < 0 && len(c.buf) < maxHeaderBlock {
+		return len(p), nil
+	}
+
+	c.done = true
+	out := c.buf
+	if end >= 0 {
+		out = append(reorderHeaderBlock(c.buf[:end], c.rank), c.buf[end:]...)
+	}
+	c.buf = nil
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// reorderHeaderBlock sorts the header lines after the request line by rank,
+// keeping unranked headers last in their original order
+func reorderHeaderBlock(block []byte, rank map[string]int) []byte {
+	lines := bytes.Split(block, []byte("\r\n"))
+	headers := append([][]byte(nil), lines[1:]...)
+
+	position := func(line []byte) int {
+		if r, ok := rank[headerLineName(line)]; ok {
+			return r
+		}
+		return len(rank)
+	}
+	sort.SliceStable(headers, func(i, j int) bool {
+		return position(headers[i]) < position(headers[j])
+	})
+	return bytes.Join(append([][]byte{lines[0]}, headers...), []byte("\r\n"))
+}
+
+// headerLineName returns the canonical name of a "Name: value" header line
+func headerLineName(line []byte) string {
+	name, _, _ := bytes.Cut(line, []byte(":"))
+	return http.CanonicalHeaderKey(string(bytes.TrimSpace(name)))
+}
+
+// supportedEncoding reports whether responses in a content encoding can be decoded
+func supportedEncoding(encoding string) bool {
+	switch strings.ToLower(encoding) {
+	case "gzip", "x-gzip", "deflate", "br", "zstd", "identity", "*":
+		return true
+	}
+	return false
+}
+
+// decodeBody wraps body in a decoder for one content encoding
+func decodeBody(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(encoding) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		// deflate is meant to be zlib-wrapped, but some servers send raw deflate
+		buffered := bufio.NewReader(body)
+		header, _ := buffered.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			return zlib.NewReader(buffered)
+		}
+		return flate.NewReader(buffered), nil
+	case "br":
+		return brotli.NewReader(body), nil
+	case "zstd":
+		decoder, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case "identity", "":
+		return body, nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// decompressResponse replaces a compressed response body with the decoded
+// content, undoing each listed encoding in reverse order
+func decompressResponse(resp *http.Response) error {
+	encodings := strings.Split(resp.Header.Get("Content-Encoding"), ",")
+	if len(encodings) == 1 && strings.TrimSpace(encodings[0]) == "" {
+		return nil
+	}
+
+	var body io.Reader = resp.Body
+	closers := []io.Closer{resp.Body}
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decoded, err := decodeBody(strings.TrimSpace(encodings[i]), body)
+		if err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		if closer, ok := decoded.(io.Closer); ok && decoded != body {
+			closers = append(closers, closer)
+		}
+		body = decoded
+	}
+
+	resp.Body = &decodedBody{Reader: body, closers: closers}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decodedBody reads decoded content and closes the decoders and the
+// original body
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if closeErr := b.closers[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// profileTransport sends every request with the profile's headers and
+// transparently decompresses the responses
+type profileTransport struct {
+	base    http.RoundTripper
+	profile RequestProfile
+}
+
+func (t *profileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	t.profile.apply(req.Header, req.URL)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := decompressResponse(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// clientProfile returns the name of the request profile a client sends
+func clientProfile(client *http.Client) string {
+	if transport, ok := client.Transport.(*profileTransport); ok {
+		return transport.profile.Name
+	}
+	return ""
+}
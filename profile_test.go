@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// captureRequestHeaders sends one request through a client built like
+// createTorClient's and returns the header lines the server received
+func captureRequestHeaders(t *testing.T, profile RequestProfile) []string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var lines []string
+		for {
+			line, err := reader.ReadString('\n')
+			line = strings.TrimRight(line, "\r\n")
+			if err != nil || line == "" {
+				break
+			}
+			lines = append(lines, line)
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok"))
+		received <- lines
+	}()
+
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := net.Dial(network, listener.Addr().String())
+			if err != nil {
+				return nil, err
+			}
+			return profile.wrapConn(conn), nil
+		},
+		DisableKeepAlives:  true,
+		DisableCompression: true,
+	}
+	client := &http.Client{Transport: &profileTransport{base: transport, profile: profile}}
+	resp, err := client.Get("http://localhost/")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return <-received
+}
+
+func TestProfileWireHeaders(t *testing.T) {
+	profile, err := newRequestProfile(&YAMLConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := captureRequestHeaders(t, profile)
+	if len(lines) == 0 || lines[0] != "GET / HTTP/1.1" {
+		t.Fatalf("request = %q, want a GET request line", lines)
+	}
+
+	var names []string
+	connection := 0
+	for _, line := range lines[1:] {
+		name, value, _ := strings.Cut(line, ": ")
+		names = append(names, name)
+		if name == "Connection" {
+			connection++
+			if value != "close" {
+				t.Errorf("Connection: %s, want close since keep-alives are disabled", value)
+			}
+		}
+	}
+	if connection != 1 {
+		t.Errorf("got %d Connection headers, want 1", connection)
+	}
+	want := []string{
+		"Host", "User-Agent", "Accept", "Accept-Language", "Accept-Encoding", "Connection",
+		"Upgrade-Insecure-Requests", "Sec-Fetch-Dest", "Sec-Fetch-Mode", "Sec-Fetch-Site", "Sec-Fetch-User", "Priority",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("header order = %v, want %v", names, want)
+	}
+}
+
+func TestProfileIgnoresConnectionHeader(t *testing.T) {
+	profile, err := newRequestProfile(&YAMLConfig{
+		RequestProfile: ProfileCustom,
+		CustomProfile:  &RequestProfile{Headers: map[string]string{"Connection": "keep-alive", "X-Test": "1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	profile.apply(header, &url.URL{Scheme: "http", Host: "abc.onion"})
+	if header.Get("Connection") != "" || header.Get("X-Test") != "1" {
+		t.Errorf("headers = %v, want X-Test without Connection", header)
+	}
+}
+
+func TestNewRequestProfileErrors(t *testing.T) {
+	for _, config := range []*YAMLConfig{
+		{RequestProfile: "netscape"},
+		{RequestProfile: ProfileCustom, CustomProfile: &RequestProfile{AcceptEncoding: "gzip, compress"}},
+	} {
+		if _, err := newRequestProfile(config); err == nil {
+			t.Errorf("newRequestProfile(%+v) succeeded, want error", config)
+		}
+	}
+}
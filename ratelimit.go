@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default per-host politeness limits
+const (
+	defaultRequestsPerSecond = 1.0
+	defaultBurst             = 1
+	defaultMaxConnections    = 2
+)
+
+// RateLimit limits the requests sent to a single host
+type RateLimit struct {
+	// RequestsPerSecond is the token bucket refill rate
+	RequestsPerSecond float64 `yaml:"requests_per_second,omitempty"`
+	// Burst is the number of requests that may be sent back to back
+	Burst int `yaml:"burst,omitempty"`
+	// MaxConnections bounds the requests in flight to the host at once
+	MaxConnections int `yaml:"max_connections,omitempty"`
+	// Jitter is the upper bound of a random delay before each request, e.g. "500ms"
+	Jitter string `yaml:"jitter,omitempty"`
+}
+
+// hostLimit is a parsed RateLimit
+type hostLimit struct {
+	rate           float64
+	burst          int
+	maxConnections int
+	jitter         time.Duration
+}
+
+// merge returns limit with the fields set in override replaced
+func (l RateLimit) merge(override *RateLimit) RateLimit {
+	if override == nil {
+		return l
+	}
+	if override.RequestsPerSecond != 0 {
+		l.RequestsPerSecond = override.RequestsPerSecond
+	}
+	if override.Burst != 0 {
+		l.Burst = override.Burst
+	}
+	if override.MaxConnections != 0 {
+		l.MaxConnections = override.MaxConnections
+	}
+	if override.Jitter != "" {
+		l.Jitter = override.Jitter
+	}
+	return l
+}
+
+// parse validates a rate limit
+func (l RateLimit) parse() (hostLimit, error) {
+	limit := hostLimit{rate: l.RequestsPerSecond, burst: l.Burst, maxConnections: l.MaxConnections}
+	if l.RequestsPerSecond < 0 || l.Burst < 0 || l.MaxConnections < 0 {
+		return limit, fmt.Errorf("rate limits must not be negative")
+	}
+	if l.Jitter != "" {
+		jitter, err := time.ParseDuration(l.Jitter)
+		if err != nil || jitter < 0 {
+			return limit, fmt.Errorf("invalid jitter %q", l.Jitter)
+		}
+		limit.jitter = jitter
+	}
+	return limit, nil
+}
+
+// tokenBucket is a token bucket handing out reservations, so concurrent
+// callers are spaced out in arrival order
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a full bucket, or nil when rate is unlimited
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait takes a token, sleeping until it is available
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+	return sleepContext(ctx, delay)
+}
+
+// sleepContext sleeps for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hostState is the live rate limiting state of one host
+type hostState struct {
+	limit  hostLimit
+	bucket *tokenBucket
+	slots  chan struct{}
+}
+
+// rateLimiter applies per-host token buckets, connection limits and jitter,
+// and a global requests-per-minute cap
+type rateLimiter struct {
+	defaults  hostLimit
+	overrides map[string]hostLimit
+	global    *tokenBucket
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+// newRateLimiter builds the rate limiter from the config defaults and the
+// targets' overrides
+func newRateLimiter(config *YAMLConfig) (*rateLimiter, error) {
+	base := RateLimit{RequestsPerSecond: defaultRequestsPerSecond, Burst: defaultBurst, MaxConnections: defaultMaxConnections}
+	defaults, err := base.merge(config.RateLimit).parse()
+	if err != nil {
+		return nil, fmt.Errorf("rate_limit: %w", err)
+	}
+	if config.RequestsPerMinute < 0 {
+		return nil, fmt.Errorf("requests_per_minute must not be negative")
+	}
+
+	limiter := &rateLimiter{
+		defaults:  defaults,
+		overrides: make(map[string]hostLimit),
+		global:    newTokenBucket(float64(config.RequestsPerMinute)/60, 1),
+		hosts:     make(map[string]*hostState),
+	}
+	for _, target := range config.Targets {
+		if target.RateLimit == nil {
+			continue
+		}
+		host := rateLimitHost(target.CanonicalURL)
+		if _, ok := limiter.overrides[host]; ok || host == "" {
+			continue
+		}
+		limit, err := base.merge(config.RateLimit).merge(target.RateLimit).parse()
+		if err != nil {
+			return nil, fmt.Errorf("target %s: rate_limit: %w", target.URL, err)
+		}
+		limiter.overrides[host] = limit
+	}
+	return limiter, nil
+}
+
+// rateLimitHost returns the host a URL's requests are limited under. Onion
+// subdomains share their service's limit.
+func rateLimitHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if host, ok := onionServiceHost(u.Hostname()); ok {
+		return host
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// state returns the limiter state of a host, creating it on first use
+func (l *rateLimiter) state(host string) *hostState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if state, ok := l.hosts[host]; ok {
+		return state
+	}
+	limit, ok := l.overrides[host]
+	if !ok {
+		limit = l.defaults
+	}
+	state := &hostState{limit: limit, bucket: newTokenBucket(limit.rate, limit.burst)}
+	if limit.maxConnections > 0 {
+		state.slots = make(chan struct{}, limit.maxConnections)
+	}
+	l.hosts[host] = state
+	return state
+}
+
+// acquire waits until a request to rawURL may be sent and returns the
+// function releasing its connection slot
+func (l *rateLimiter) acquire(ctx context.Context, rawURL string) (func(), error) {
+	state := l.state(rateLimitHost(rawURL))
+
+	release := func() {}
+	if state.slots != nil {
+		select {
+		case state.slots <- struct{}{}:
+			var once sync.Once
+			release = func() { once.Do(func() { <-state.slots }) }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if state.limit.jitter > 0 {
+		if err := sleepContext(ctx, time.Duration(rand.Int63n(int64(state.limit.jitter)))); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	if err := state.bucket.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	if err := l.global.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// rateLimitTransport waits for the rate limiter before every request and
+// holds the host's connection slot until the response body is closed
+type rateLimitTransport struct {
+	base    http.RoundTripper
+	limiter *rateLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	release, err := t.limiter.acquire(req.Context(), req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releasingBody releases a connection slot when the body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitMerge(t *testing.T) {
+	base := RateLimit{RequestsPerSecond: 1, Burst: 1, MaxConnections: 2}
+	if got := base.merge(nil); got != base {
+		t.Errorf("merge(nil) = %+v, want %+v", got, base)
+	}
+	got := base.merge(&RateLimit{RequestsPerSecond: 0.5, Jitter: "1s"})
+	want := RateLimit{RequestsPerSecond: 0.5, Burst: 1, MaxConnections: 2, Jitter: "1s"}
+	if got != want {
+		t.Errorf("merge() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRateLimitParse(t *testing.T) {
+	tests := []struct {
+		limit RateLimit
+		ok    bool
+	}{
+		{RateLimit{RequestsPerSecond: 2, Burst: 3, MaxConnections: 1, Jitter: "250ms"}, true},
+		{RateLimit{}, true},
+		{RateLimit{RequestsPerSecond: -1}, false},
+		{RateLimit{Burst: -1}, false},
+		{RateLimit{MaxConnections: -2}, false},
+		{RateLimit{Jitter: "soon"}, false},
+		{RateLimit{Jitter: "500"}, false},
+		{RateLimit{Jitter: "-1s"}, false},
+	}
+	for _, tt := range tests {
+		limit, err := tt.limit.parse()
+		if (err == nil) != tt.ok {
+			t.Errorf("parse(%+v) = %v, want ok: %v", tt.limit, err, tt.ok)
+		}
+		if err == nil && tt.limit.Jitter == "250ms" && limit.jitter != 250*time.Millisecond {
+			t.Errorf("jitter = %v, want 250ms", limit.jitter)
+		}
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	// Two back to back, then spaced 50ms apart
+	bucket := newTokenBucket(20, 2)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond || elapsed > time.Second {
+		t.Errorf("5 requests at 20/s with a burst of 2 took %v, want about 150ms", elapsed)
+	}
+
+	if newTokenBucket(0, 1) != nil {
+		t.Errorf("newTokenBucket(0) is not nil, want unlimited")
+	}
+	var unlimited *tokenBucket
+	if err := unlimited.wait(context.Background()); err != nil {
+		t.Errorf("nil bucket wait() = %v", err)
+	}
+
+	slow := newTokenBucket(0.1, 1)
+	slow.wait(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := slow.wait(ctx); err == nil {
+		t.Errorf("wait() on an empty bucket ignored the context deadline")
+	}
+}
+
+func TestRateLimitHost(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://" + testOnionV3 + ".onion/", testOnionV3 + ".onion"},
+		{"http://www.forum." + testOnionV3 + ".onion:8080/x", testOnionV3 + ".onion"},
+		{"https://Example.COM:8443/", "example.com"},
+		{"https://www.example.com/", "www.example.com"},
+		{"%zz", ""},
+	}
+	for _, tt := range tests {
+		if got := rateLimitHost(tt.url); got != tt.want {
+			t.Errorf("rateLimitHost(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestNewRateLimiterOverrides(t *testing.T) {
+	config := &YAMLConfig{
+		RateLimit: &RateLimit{Burst: 3},
+		Targets: []Target{
+			withCanonicalURL(Target{URL: "http://www." + testOnionV3 + ".onion/", RateLimit: &RateLimit{MaxConnections: 1}}),
+		},
+	}
+	limiter, err := newRateLimiter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The override applies to the whole onion service, on top of the defaults
+	state := limiter.state(rateLimitHost("http://" + testOnionV3 + ".onion/"))
+	if state.limit.maxConnections != 1 || state.limit.burst != 3 || state.limit.rate != defaultRequestsPerSecond {
+		t.Errorf("onion limit = %+v", state.limit)
+	}
+	if other := limiter.state("example.com"); other.limit.maxConnections != defaultMaxConnections {
+		t.Errorf("default limit = %+v", other.limit)
+	}
+
+	config.Targets[0].RateLimit = &RateLimit{Jitter: "x"}
+	if _, err := newRateLimiter(config); err == nil {
+		t.Errorf("newRateLimiter() accepted an invalid target jitter")
+	}
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRateLimitTransportHoldsSlotUntilClose(t *testing.T) {
+	limiter, err := newRateLimiter(&YAMLConfig{RateLimit: &RateLimit{RequestsPerSecond: 1000, Burst: 10, MaxConnections: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &rateLimitTransport{
+		limiter: limiter,
+		base: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("ok"))}, nil
+		}),
+	}
+	roundTrip := func(timeout time.Duration) (*http.Response, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://"+testOnionV3+".onion/", nil)
+		return transport.RoundTrip(req)
+	}
+
+	first, err := roundTrip(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := roundTrip(50 * time.Millisecond); err == nil {
+		t.Fatalf("second request got a slot while the first body was open")
+	}
+
+	// Reading the body does not free the slot; closing it does, once
+	io.ReadAll(first.Body)
+	if _, err := roundTrip(50 * time.Millisecond); err == nil {
+		t.Fatalf("reading the body released the slot")
+	}
+	first.Body.Close()
+	first.Body.Close()
+	second, err := roundTrip(time.Second)
+	if err != nil {
+		t.Fatalf("request after Body.Close() = %v", err)
+	}
+	if _, err := roundTrip(50 * time.Millisecond); err == nil {
+		t.Errorf("a double Close() released two slots")
+	}
+	second.Body.Close()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redirect policy modes
+const (
+	RedirectFollowAll = "follow-all"
+	RedirectSameHost  = "same-host-only"
+	RedirectOnionOnly = "onion-only"
+	RedirectNone      = "none"
+)
+
+// defaultMaxRedirects matches Go's default redirect limit
+const defaultMaxRedirects = 10
+
+// RedirectPolicy decides which redirects the Tor client follows
+type RedirectPolicy struct {
+	Mode    string
+	MaxHops int
+}
+
+// RedirectHop is one redirect response in a request's redirect chain
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location"`
+	// Blocked is set when the policy refused to follow this redirect
+	Blocked bool `json:"blocked,omitempty"`
+}
+
+// redirectChainKey is the request context key of the redirect chain recorder
+type redirectChainKey struct{}
+
+// newRedirectPolicy builds the redirect policy from the config, defaulting
+// to following up to ten redirects anywhere
+func newRedirectPolicy(config *YAMLConfig) (RedirectPolicy, error) {
+	policy := RedirectPolicy{Mode: config.Redirects, MaxHops: defaultMaxRedirects}
+	if policy.Mode == "" {
+		policy.Mode = RedirectFollowAll
+	}
+	switch policy.Mode {
+	case RedirectFollowAll, RedirectSameHost, RedirectOnionOnly, RedirectNone:
+	default:
+		return policy, fmt.Errorf("unknown redirect mode %q", config.Redirects)
+	}
+	if config.MaxRedirects != nil {
+		if *config.MaxRedirects < 0 {
+			return policy, fmt.Errorf("max_redirects must not be negative")
+		}
+		policy.MaxHops = *config.MaxRedirects
+	}
+	return policy, nil
+}
+
+// allows reports why a redirect from the original URL to target is refused,
+// or nil when it may be followed
+func (p RedirectPolicy) allows(original, target *url.URL) error {
+	switch p.Mode {
+	case RedirectNone:
+		return fmt.Errorf("redirects are disabled")
+	case RedirectSameHost:
+		if !strings.EqualFold(original.Hostname(), target.Hostname()) {
+			return fmt.Errorf("%s is not %s", target.Hostname(), original.Hostname())
+		}
+	case RedirectOnionOnly:
+		if !isOnionURL(target.String()) {
+			return fmt.Errorf("%s is not an onion host", target.Hostname())
+		}
+	}
+	return nil
+}
+
+// checkRedirect is the client's CheckRedirect hook. It records each hop in
+// the request's redirect chain, if one is attached, and stops redirects the
+// policy refuses, returning the redirect response itself.
+func (p RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	chain, _ := req.Context().Value(redirectChainKey{}).(*[]RedirectHop)
+	hop := RedirectHop{URL: via[len(via)-1].URL.String(), Location: req.URL.String()}
+	if req.Response != nil {
+		hop.StatusCode = req.Response.StatusCode
+	}
+
+	err := p.allows(via[0].URL, req.URL)
+	if len(via) > p.MaxHops {
+		err = fmt.Errorf("stopped after %d redirects", p.MaxHops)
+	}
+	if err != nil {
+		hop.Blocked = true
+		if chain != nil {
+			*chain = append(*chain, hop)
+		}
+		fmt.Printf("[WARN] Redirect from %s to %s blocked: %v\n", hop.URL, hop.Location, err)
+		return http.ErrUseLastResponse
+	}
+
+	if chain != nil {
+		*chain = append(*chain, hop)
+	}
+	return nil
+}
+
+// withRedirectChain attaches a redirect chain recorder to a request
+func withRedirectChain(req *http.Request) (*http.Request, *[]RedirectHop) {
+	chain := &[]RedirectHop{}
+	return req.WithContext(context.WithValue(req.Context(), redirectChainKey{}, chain)), chain
+}
+
+// formatRedirects summarizes a redirect chain on one line
+func formatRedirects(chain []RedirectHop) string {
+	var parts []string
+	for _, hop := range chain {
+		parts = append(parts, fmt.Sprintf("%s (%d)", hop.URL, hop.StatusCode))
+	}
+	last := chain[len(chain)-1]
+	if last.Blocked {
+		return strings.Join(parts, " -> ") + " -> " + last.Location + " [blocked]"
+	}
+	return strings.Join(parts, " -> ") + " -> " + last.Location
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckRedirect(t *testing.T) {
+	// /0 redirects to /1, /1 to /2, and /2 is the final page
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0":
+			http.Redirect(w, r, "/1", http.StatusFound)
+		case "/1":
+			http.Redirect(w, r, "/2", http.StatusMovedPermanently)
+		default:
+			w.Write([]byte("done"))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		policy  RedirectPolicy
+		status  int
+		hops    int
+		blocked bool
+	}{
+		{"follow all", RedirectPolicy{Mode: RedirectFollowAll, MaxHops: defaultMaxRedirects}, http.StatusOK, 2, false},
+		{"limit reached", RedirectPolicy{Mode: RedirectFollowAll, MaxHops: 1}, http.StatusMovedPermanently, 2, true},
+		{"max_redirects 0", RedirectPolicy{Mode: RedirectFollowAll, MaxHops: 0}, http.StatusFound, 1, true},
+		{"none", RedirectPolicy{Mode: RedirectNone, MaxHops: defaultMaxRedirects}, http.StatusFound, 1, true},
+		{"same host", RedirectPolicy{Mode: RedirectSameHost, MaxHops: defaultMaxRedirects}, http.StatusOK, 2, false},
+	}
+	for _, tt := range tests {
+		client := &http.Client{CheckRedirect: tt.policy.checkRedirect}
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/0", nil)
+		req, chain := withRedirectChain(req)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("%s: request failed: %v", tt.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+		if len(*chain) != tt.hops || (*chain)[len(*chain)-1].Blocked != tt.blocked {
+			t.Errorf("%s: chain = %+v, want %d hops with blocked=%v on the last", tt.name, *chain, tt.hops, tt.blocked)
+		}
+	}
+}
+
+func TestNewRedirectPolicy(t *testing.T) {
+	zero, negative := 0, -1
+	policy, err := newRedirectPolicy(&YAMLConfig{MaxRedirects: &zero})
+	if err != nil || policy.Mode != RedirectFollowAll || policy.MaxHops != 0 {
+		t.Errorf("newRedirectPolicy(max_redirects: 0) = %+v, %v", policy, err)
+	}
+	if _, err := newRedirectPolicy(&YAMLConfig{MaxRedirects: &negative}); err == nil {
+		t.Errorf("newRedirectPolicy(max_redirects: -1) succeeded, want error")
+	}
+	if _, err := newRedirectPolicy(&YAMLConfig{Redirects: "sometimes"}); err == nil {
+		t.Errorf("newRedirectPolicy(redirects: sometimes) succeeded, want error")
+	}
+}
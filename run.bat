@@ -64,7 +64,7 @@ call go mod tidy
 echo.
 echo [INFO] Building project...
 if exist tor-scraper.exe del tor-scraper.exe
-call go build -o tor-scraper.exe main.go
+call go build -o tor-scraper.exe .
 
 if %ERRORLEVEL% NEQ 0 (
     echo [ERROR] Build failed!
@@ -57,7 +57,7 @@ go mod tidy
 echo ""
 echo "[INFO] Building project..."
 rm -f tor-scraper
-go build -o tor-scraper main.go
+go build -o tor-scraper .
 
 if [ $? -ne 0 ]; then
     echo "[ERROR] Build failed!"
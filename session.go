@@ -0,0 +1,732 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// defaultSessionDir is where cookie jars are kept, next to the targets file
+const defaultSessionDir = "sessions"
+
+// SessionConfig is a named cookie jar shared by the targets referencing it
+type SessionConfig struct {
+	// CookiesFile is a Netscape cookies.txt file imported into the jar,
+	// e.g. exported from Tor Browser
+	CookiesFile string `yaml:"cookies_file,omitempty"`
+	// LoggedOut is a regex found on pages served to a logged-out visitor
+	LoggedOut string `yaml:"logged_out,omitempty"`
+	// Login re-establishes the session when it is logged out
+	Login *LoginStep `yaml:"login,omitempty"`
+}
+
+// LoginStep submits a login form
+type LoginStep struct {
+	// URL is the page holding the login form
+	URL string `yaml:"url"`
+	// Action is where the form is submitted, by default the form's own action
+	Action string `yaml:"action,omitempty"`
+	// Fields are the values filled into the form; "${VAR}" reads an
+	// environment variable
+	Fields map[string]string `yaml:"fields"`
+	// Success is a regex found on the page returned after a successful login
+	Success string `yaml:"success,omitempty"`
+}
+
+// sessionCookie is a stored cookie with the fields of a cookies.txt line
+type sessionCookie struct {
+	domain   string
+	hostOnly bool
+	path     string
+	secure   bool
+	httpOnly bool
+	// expires is zero for a session cookie
+	expires time.Time
+	name    string
+	value   string
+	// created orders cookies with equally long paths, as browsers do
+	created int
+}
+
+func (c *sessionCookie) key() string {
+	return c.domain + ";" + c.path + ";" + c.name
+}
+
+func (c *sessionCookie) expired(now time.Time) bool {
+	return !c.expires.IsZero() && !c.expires.After(now)
+}
+
+// session is the live cookie jar of one named session
+type session struct {
+	name      string
+	file      string
+	config    SessionConfig
+	loggedOut *regexp.Regexp
+	success   *regexp.Regexp
+
+	mu      sync.Mutex
+	cookies map[string]*sessionCookie
+	created int
+}
+
+// sessionJar is the client's cookie jar. It routes each request to the
+// session of its host; hosts without a session get no cookies.
+type sessionJar struct {
+	dir      string
+	sessions map[string]*session
+	hosts    map[string]*session
+}
+
+// newSessionJar builds the cookie jars of the sessions the targets use,
+// loading the cookies saved by earlier runs and importing cookies files.
+// It returns nil when no target uses a session.
+func newSessionJar(config *YAMLConfig, targetsFile string) (*sessionJar, error) {
+	dir := config.SessionDir
+	if dir == "" {
+		dir = defaultSessionDir
+	}
+	jar := &sessionJar{
+		dir:      resolveConfigPath(targetsFile, dir),
+		sessions: make(map[string]*session),
+		hosts:    make(map[string]*session),
+	}
+
+	for _, target := range config.Targets {
+		if target.Session == "" {
+			continue
+		}
+		s, ok := jar.sessions[target.Session]
+		if !ok {
+			var err error
+			if s, err = newSession(target.Session, config.Sessions[target.Session], jar.dir, targetsFile); err != nil {
+				return nil, err
+			}
+			jar.sessions[target.Session] = s
+		}
+		if err := jar.addHost(target.CanonicalURL, s); err != nil {
+			return nil, err
+		}
+		if s.config.Login != nil {
+			if err := jar.addHost(s.config.Login.URL, s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(jar.sessions) == 0 {
+		return nil, nil
+	}
+	return jar, nil
+}
+
+// checkTargetSessions reports targets naming a session that is not defined,
+// and copies of one target naming different sessions
+func checkTargetSessions(config *YAMLConfig) error {
+	sessions := make(map[string]string)
+	for _, target := range config.Targets {
+		if target.Session == "" {
+			continue
+		}
+		if _, ok := config.Sessions[target.Session]; !ok {
+			return fmt.Errorf("target %s: undefined session %q", target.URL, target.Session)
+		}
+		key := target.CanonicalURL
+		if key == "" {
+			key = target.URL
+		}
+		if other, ok := sessions[key]; ok && other != target.Session {
+			return fmt.Errorf("target %s uses sessions %s and %s", key, other, target.Session)
+		}
+		sessions[key] = target.Session
+	}
+	return nil
+}
+
+// addHost routes the cookies of a URL's host to a session. Onion subdomains
+// share their service's session.
+func (j *sessionJar) addHost(rawURL string, s *session) error {
+	host := rateLimitHost(rawURL)
+	if host == "" {
+		return fmt.Errorf("session %s: invalid URL %q", s.name, rawURL)
+	}
+	if other, ok := j.hosts[host]; ok && other != s {
+		return fmt.Errorf("host %s is used by sessions %s and %s", host, other.name, s.name)
+	}
+	j.hosts[host] = s
+	return nil
+}
+
+// newSession validates a session's settings and loads its cookies. A session
+// without settings just keeps the cookies the sites set.
+func newSession(name string, config *SessionConfig, dir, targetsFile string) (*session, error) {
+	s := &session{
+		name:    name,
+		file:    filepath.Join(dir, contentFileName(name)+".cookies.txt"),
+		cookies: make(map[string]*sessionCookie),
+	}
+	if config != nil {
+		s.config = *config
+	}
+
+	var err error
+	if s.config.LoggedOut != "" {
+		if s.loggedOut, err = regexp.Compile("(?i)" + s.config.LoggedOut); err != nil {
+			return nil, fmt.Errorf("session %s: invalid logged_out pattern: %w", name, err)
+		}
+	}
+	if login := s.config.Login; login != nil {
+		if login.URL == "" || len(login.Fields) == 0 {
+			return nil, fmt.Errorf("session %s: login needs a url and fields", name)
+		}
+		if login.Success != "" {
+			if s.success, err = regexp.Compile("(?i)" + login.Success); err != nil {
+				return nil, fmt.Errorf("session %s: invalid login success pattern: %w", name, err)
+			}
+		}
+	}
+
+	saved, err := os.Stat(s.file)
+	if err == nil {
+		if err := s.loadCookiesFile(s.file); err != nil {
+			return nil, fmt.Errorf("session %s: %w", name, err)
+		}
+	}
+
+	// A cookies file is imported when it is newer than the saved jar, so
+	// cookies the sites renewed since are not rolled back on every run
+	if s.config.CookiesFile != "" {
+		path := resolveConfigPath(targetsFile, s.config.CookiesFile)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("session %s: failed to read cookies file: %w", name, err)
+		}
+		if saved == nil || info.ModTime().After(saved.ModTime()) {
+			before := len(s.cookies)
+			if err := s.loadCookiesFile(path); err != nil {
+				return nil, fmt.Errorf("session %s: %w", name, err)
+			}
+			fmt.Printf("[INFO] Imported cookies for session %s from: %s (%d new)\n", name, path, len(s.cookies)-before)
+		}
+	}
+	return s, nil
+}
+
+// forURL returns the session of a URL's host, or nil
+func (j *sessionJar) forURL(rawURL string) *session {
+	if j == nil {
+		return nil
+	}
+	return j.hosts[rateLimitHost(rawURL)]
+}
+
+// SetCookies implements http.CookieJar
+func (j *sessionJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if s := j.forURL(u.String()); s != nil {
+		s.setCookies(u, cookies)
+	}
+}
+
+// Cookies implements http.CookieJar
+func (j *sessionJar) Cookies(u *url.URL) []*http.Cookie {
+	if s := j.forURL(u.String()); s != nil {
+		return s.cookiesFor(u)
+	}
+	return nil
+}
+
+// domainMatch reports whether host is domain or one of its subdomains
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch reports whether a request path is within a cookie path
+func pathMatch(requestPath, cookiePath string) bool {
+	if requestPath == cookiePath || cookiePath == "/" {
+		return true
+	}
+	return strings.HasPrefix(requestPath, cookiePath) &&
+		(strings.HasSuffix(cookiePath, "/") || requestPath[len(cookiePath)] == '/')
+}
+
+// defaultCookiePath is the directory of a request path, as in RFC 6265
+func defaultCookiePath(requestPath string) string {
+	if i := strings.LastIndex(requestPath, "/"); i > 0 {
+		return requestPath[:i]
+	}
+	return "/"
+}
+
+// setCookies stores the cookies a response set, dropping deleted and
+// expired ones and those for another domain
+func (s *session) setCookies(u *url.URL, cookies []*http.Cookie) {
+	host := strings.ToLower(u.Hostname())
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range cookies {
+		cookie := &sessionCookie{domain: host, hostOnly: true, path: c.Path, secure: c.Secure, httpOnly: c.HttpOnly, name: c.Name, value: c.Value}
+		if c.Domain != "" {
+			domain := strings.ToLower(strings.TrimPrefix(c.Domain, "."))
+			if !domainMatch(host, domain) {
+				continue
+			}
+			cookie.domain, cookie.hostOnly = domain, false
+		}
+		if !strings.HasPrefix(cookie.path, "/") {
+			cookie.path = defaultCookiePath(u.Path)
+		}
+		switch {
+		case c.MaxAge < 0:
+			cookie.expires = now
+		case c.MaxAge > 0:
+			cookie.expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		case !c.Expires.IsZero():
+			cookie.expires = c.Expires
+		}
+
+		s.store(cookie, now)
+	}
+}
+
+// store adds or replaces a cookie, keeping the creation order of the one it
+// replaces, or deletes it when it has expired. The caller holds s.mu.
+func (s *session) store(cookie *sessionCookie, now time.Time) {
+	key := cookie.key()
+	if cookie.expired(now) {
+		delete(s.cookies, key)
+		return
+	}
+	if old, ok := s.cookies[key]; ok {
+		cookie.created = old.created
+	} else {
+		s.created++
+		cookie.created = s.created
+	}
+	s.cookies[key] = cookie
+}
+
+// cookiesFor returns the cookies to send with a request, most specific path first
+func (s *session) cookiesFor(u *url.URL) []*http.Cookie {
+	host := strings.ToLower(u.Hostname())
+	requestPath := u.Path
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	secure := potentiallyTrustworthy(u)
+	now := time.Now()
+
+	s.mu.Lock()
+	var matched []*sessionCookie
+	for _, c := range s.cookies {
+		if c.expired(now) || (c.secure && !secure) || !pathMatch(requestPath, c.path) {
+			continue
+		}
+		if (c.hostOnly && host != c.domain) || (!c.hostOnly && !domainMatch(host, c.domain)) {
+			continue
+		}
+		matched = append(matched, c)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if len(matched[i].path) != len(matched[j].path) {
+			return len(matched[i].path) > len(matched[j].path)
+		}
+		return matched[i].created < matched[j].created
+	})
+	cookies := make([]*http.Cookie, 0, len(matched))
+	for _, c := range matched {
+		cookies = append(cookies, &http.Cookie{Name: c.name, Value: c.value})
+	}
+	return cookies
+}
+
+// count returns the number of live cookies in the session
+func (s *session) count() int {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.cookies {
+		if !c.expired(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// loadCookiesFile reads a Netscape cookies.txt file into the session
+func (s *session) loadCookiesFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open cookies file: %w", err)
+	}
+	defer file.Close()
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			return fmt.Errorf("%s:%d: expected 7 tab-separated fields", path, lineNum)
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid expiry %q", path, lineNum, fields[4])
+		}
+		cookie := &sessionCookie{
+			domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			hostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			path:     fields[2],
+			secure:   strings.EqualFold(fields[3], "TRUE"),
+			httpOnly: httpOnly,
+			name:     fields[5],
+			value:    strings.Join(fields[6:], "\t"),
+		}
+		if expiry > 0 {
+			cookie.expires = time.Unix(expiry, 0)
+		}
+		if cookie.domain == "" || !strings.HasPrefix(cookie.path, "/") {
+			return fmt.Errorf("%s:%d: invalid domain or path", path, lineNum)
+		}
+		s.store(cookie, now)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read cookies file: %w", err)
+	}
+	return nil
+}
+
+// save writes the session's live cookies to its jar file in cookies.txt
+// format, readable only by the owner
+func (s *session) save() error {
+	now := time.Now()
+	s.mu.Lock()
+	var cookies []*sessionCookie
+	for _, c := range s.cookies {
+		if !c.expired(now) {
+			cookies = append(cookies, c)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(cookies, func(i, j int) bool { return cookies[i].created < cookies[j].created })
+
+	var sb strings.Builder
+	sb.WriteString("# Netscape HTTP Cookie File\n")
+	sb.WriteString(fmt.Sprintf("# Session %s, saved by tor-scraper\n\n", s.name))
+	for _, c := range cookies {
+		domain := c.domain
+		if !c.hostOnly {
+			domain = "." + domain
+		}
+		if c.httpOnly {
+			domain = "#HttpOnly_" + domain
+		}
+		var expiry int64
+		if !c.expires.IsZero() {
+			expiry = c.expires.Unix()
+		}
+		sb.WriteString(fmt.Sprintf("%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, strings.ToUpper(strconv.FormatBool(!c.hostOnly)), c.path,
+			strings.ToUpper(strconv.FormatBool(c.secure)), expiry, c.name, c.value))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.file), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	if err := os.WriteFile(s.file, []byte(sb.String()), 0600); err != nil {
+		return fmt.Errorf("failed to save session %s: %w", s.name, err)
+	}
+	return nil
+}
+
+// save writes every session's cookies to disk
+func (j *sessionJar) save() {
+	if j == nil {
+		return
+	}
+	for _, s := range j.sessions {
+		if err := s.save(); err != nil {
+			fmt.Printf("[WARN] %v\n", err)
+		}
+	}
+}
+
+// loginForm is the form found on a login page
+type loginForm struct {
+	action string
+	method string
+	values url.Values
+}
+
+// findLoginForm returns the first form with a password field, or else the
+// first form, with the values its fields would submit
+func findLoginForm(content string) *loginForm {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var forms []*html.Node
+	var findForms func(n *html.Node)
+	findForms = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "form" {
+			forms = append(forms, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			findForms(c)
+		}
+	}
+	findForms(doc)
+	if len(forms) == 0 {
+		return nil
+	}
+
+	var chosen *loginForm
+	for _, formNode := range forms {
+		form := &loginForm{action: htmlAttr(formNode, "action"), method: strings.ToUpper(htmlAttr(formNode, "method")), values: url.Values{}}
+		hasPassword, hasSubmit := false, false
+		var walk func(n *html.Node)
+		walk = func(n *html.Node) {
+			if n.Type == html.ElementNode {
+				name := htmlAttr(n, "name")
+				inputType := strings.ToLower(htmlAttr(n, "type"))
+				switch n.Data {
+				case "input":
+					switch inputType {
+					case "password":
+						hasPassword = true
+						if name != "" {
+							form.values.Set(name, htmlAttr(n, "value"))
+						}
+					case "submit", "image":
+						// Only the clicked button is submitted
+						if name != "" && !hasSubmit {
+							hasSubmit = true
+							form.values.Set(name, htmlAttr(n, "value"))
+						}
+					case "checkbox", "radio":
+						if name != "" && hasAttr(n, "checked") {
+							value := htmlAttr(n, "value")
+							if value == "" {
+								value = "on"
+							}
+							form.values.Add(name, value)
+						}
+					case "button", "reset", "file":
+					default:
+						if name != "" {
+							form.values.Add(name, htmlAttr(n, "value"))
+						}
+					}
+				case "button":
+					if name != "" && !hasSubmit && (inputType == "" || inputType == "submit") {
+						hasSubmit = true
+						form.values.Set(name, htmlAttr(n, "value"))
+					}
+				case "textarea":
+					if name != "" {
+						form.values.Add(name, nodeText(n))
+					}
+				}
+			}
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c)
+			}
+		}
+		walk(formNode)
+
+		if hasPassword {
+			return form
+		}
+		if chosen == nil {
+			chosen = form
+		}
+	}
+	return chosen
+}
+
+// hasAttr reports whether an element has the named attribute
+func hasAttr(n *html.Node, name string) bool {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// login loads the login page, fills in its form and submits it the way a
+// browser would, leaving the new session cookies in the jar
+func (s *session) login(client *http.Client) error {
+	step := s.config.Login
+	resp, body, err := fetchURL(client, step.URL, 1024*1024)
+	if err != nil {
+		return fmt.Errorf("failed to load login page: %w", err)
+	}
+	pageURL := resp.Request.URL
+
+	form := findLoginForm(string(body))
+	if form == nil {
+		form = &loginForm{values: url.Values{}}
+	}
+	action := form.action
+	if step.Action != "" {
+		action = step.Action
+	}
+	target, err := pageURL.Parse(action)
+	if err != nil {
+		return fmt.Errorf("invalid login form action %q: %w", action, err)
+	}
+	for name, value := range step.Fields {
+		form.values.Set(name, os.ExpandEnv(value))
+	}
+
+	var req *http.Request
+	if form.method == "GET" {
+		target.RawQuery = form.values.Encode()
+		req, err = http.NewRequest("GET", target.String(), nil)
+	} else {
+		req, err = http.NewRequest("POST", target.String(), strings.NewReader(form.values.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Origin", pageURL.Scheme+"://"+pageURL.Host)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create login request: %w", err)
+	}
+	req.Header.Set("Referer", pageURL.String())
+	req.Header.Set("Sec-Fetch-Site", "same-origin")
+
+	resp, err = client.Do(req)
+	if err != nil {
+		return fmt.Errorf("login request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err = io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return fmt.Errorf("failed to read login response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("login returned HTTP %d", resp.StatusCode)
+	case s.success != nil && !s.success.Match(body):
+		return fmt.Errorf("login success marker not found")
+	case s.success == nil && s.loggedOut != nil && s.loggedOut.Match(body):
+		return fmt.Errorf("page is still logged out after login")
+	}
+	return nil
+}
+
+// openSessions logs in the sessions that have a login step but no cookies
+// yet, so the scan starts logged in
+func openSessions(client *http.Client, options analysisOptions) {
+	jar := options.Client.Sessions
+	if jar == nil {
+		return
+	}
+	for _, s := range jar.sessions {
+		if s.config.Login == nil || s.count() > 0 {
+			continue
+		}
+		fmt.Printf("[INFO] Logging in session %s at %s\n", s.name, s.config.Login.URL)
+		if err := s.login(client); err != nil {
+			fmt.Printf("[WARN] Login for session %s failed: %v\n", s.name, err)
+			continue
+		}
+		fmt.Printf("[SUCCESS] Session %s logged in\n", s.name)
+	}
+	jar.save()
+}
+
+// handleSessions tags results with their session and, when a page shows the
+// session's logged-out marker, logs in again once per run and refetches the
+// page. The cookie jars are saved afterwards.
+func handleSessions(client *http.Client, report *ScanReport, options analysisOptions) {
+	jar := options.Client.Sessions
+	if jar == nil {
+		return
+	}
+	targets := make(map[string]Target)
+	for _, target := range options.Targets {
+		targets[target.CanonicalURL] = target
+	}
+
+	logins := make(map[*session]error)
+	rescanned := false
+	report.Successful, report.Failed = 0, 0
+	for i := range report.Results {
+		result := report.Results[i]
+		s := jar.forURL(resultKey(result))
+		if s != nil {
+			result.Session = s.name
+		}
+		loggedOut := s != nil && s.loggedOut != nil && result.Status == "SUCCESS" && s.loggedOut.MatchString(result.Content)
+
+		// Mocked targets would return the same page after logging in
+		if loggedOut && s.config.Login != nil && targets[resultKey(result)].MockResponse == "" {
+			err, tried := logins[s]
+			if !tried {
+				fmt.Printf("[INFO] Session %s is logged out, logging in at %s\n", s.name, s.config.Login.URL)
+				err = s.login(client)
+				logins[s] = err
+				if err != nil {
+					fmt.Printf("[WARN] Login for session %s failed: %v\n", s.name, err)
+				} else {
+					fmt.Printf("[SUCCESS] Session %s logged in\n", s.name)
+				}
+			}
+			if err == nil {
+				// The logged-in page can still be behind a queue or CAPTCHA
+				result = rescanResult(client, result, requestURL(result.URL))
+				result = resolveChallenge(client, result, targets[resultKey(result)], options.Challenges)
+				result.Session = s.name
+				loggedOut = result.Status == "SUCCESS" && s.loggedOut.MatchString(result.Content)
+				rescanned = true
+			}
+		}
+		if loggedOut {
+			result.LoggedOut = true
+			fmt.Printf("[WARN] %s -> logged out of session %s\n", resultKey(result), s.name)
+		}
+
+		report.Results[i] = result
+		if result.Status == "SUCCESS" {
+			report.Successful++
+		} else {
+			report.Failed++
+		}
+	}
+	if rescanned {
+		report.Gated = countGated(report.Results)
+	}
+	jar.save()
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckTargetSessions(t *testing.T) {
+	sessions := map[string]*SessionConfig{"forum": {}, "market": {}}
+	tests := []struct {
+		name    string
+		targets []Target
+		wantErr string
+	}{
+		{
+			name: "defined",
+			targets: []Target{
+				{URL: "http://abc.onion/", CanonicalURL: "http://abc.onion/", Session: "forum"},
+				{URL: "abc.onion", CanonicalURL: "http://abc.onion/"},
+				{URL: "http://def.onion/", CanonicalURL: "http://def.onion/"},
+			},
+		},
+		{
+			name:    "undefined",
+			targets: []Target{{URL: "http://abc.onion/", CanonicalURL: "http://abc.onion/", Session: "froum"}},
+			wantErr: `undefined session "froum"`,
+		},
+		{
+			name: "conflicting copies",
+			targets: []Target{
+				{URL: "http://abc.onion/", CanonicalURL: "http://abc.onion/", Session: "forum"},
+				{URL: "abc.onion", CanonicalURL: "http://abc.onion/", Session: "market"},
+			},
+			wantErr: "uses sessions forum and market",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTargetSessions(&YAMLConfig{Targets: tt.targets, Sessions: sessions})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkTargetSessions() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkTargetSessions() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadTargetsRejectsUndefinedSession(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.yaml")
+	config := "sessions:\n  forum:\n    logged_out: 'log in'\ntargets:\n  - url: http://abc.onion/\n    session: forun\n"
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := loadTargets(path); err == nil {
+		t.Fatalf("loadTargets() succeeded with an undefined session")
+	}
+}
+
+func TestLoadCookiesFile(t *testing.T) {
+	future := time.Now().Add(24 * time.Hour).Unix()
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	content := "# Netscape HTTP Cookie File\n\n" +
+		"#HttpOnly_.Example.onion\tTRUE\t/\tFALSE\t0\tsid\tabc\n" +
+		fmt.Sprintf("forum.example.onion\tFALSE\t/board\tTRUE\t%d\tpref\tdark\tmode\r\n", future) +
+		"old.example.onion\tFALSE\t/\tFALSE\t1\tgone\tx\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &session{name: "test", cookies: make(map[string]*sessionCookie)}
+	if err := s.loadCookiesFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if s.count() != 2 {
+		t.Fatalf("loaded %d cookies, want 2 without the expired one", s.count())
+	}
+	sid := s.cookies["example.onion;/;sid"]
+	if sid == nil || sid.hostOnly || !sid.httpOnly || sid.secure || !sid.expires.IsZero() || sid.value != "abc" {
+		t.Errorf("sid = %+v, want a domain-wide HttpOnly session cookie", sid)
+	}
+	pref := s.cookies["forum.example.onion;/board;pref"]
+	if pref == nil || !pref.hostOnly || pref.httpOnly || !pref.secure || pref.expires.Unix() != future || pref.value != "dark\tmode" {
+		t.Errorf("pref = %+v, want a host-only secure cookie keeping the tab in its value", pref)
+	}
+
+	tests := []struct {
+		line    string
+		wantErr string
+	}{
+		{"example.onion\tFALSE\t/\tFALSE\tsoon\tsid\tabc", `:2: invalid expiry "soon"`},
+		{"example.onion\tFALSE\t/\tFALSE\t0\tsid", ":2: expected 7 tab-separated fields"},
+		{"example.onion\tFALSE\tboard\tFALSE\t0\tsid\tabc", ":2: invalid domain or path"},
+		{".\tTRUE\t/\tFALSE\t0\tsid\tabc", ":2: invalid domain or path"},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte("# header\n"+tt.line+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := (&session{cookies: make(map[string]*sessionCookie)}).loadCookiesFile(path)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("loadCookiesFile(%q) = %v, want %q", tt.line, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSessionSaveAndLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sessions", "forum.cookies.txt")
+	s := &session{name: "forum", file: file, cookies: make(map[string]*sessionCookie)}
+	u, _ := url.Parse("http://www.example.onion/board/index.php")
+	s.setCookies(u, []*http.Cookie{
+		{Name: "sid", Value: "abc", HttpOnly: true},
+		{Name: "pref", Value: "dark", Domain: ".example.onion", Path: "/", Secure: true, MaxAge: 3600},
+		{Name: "deleted", Value: "x", MaxAge: -1},
+		{Name: "foreign", Value: "x", Domain: "other.onion"},
+	})
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("cookie jar mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded := &session{name: "forum", cookies: make(map[string]*sessionCookie)}
+	if err := loaded.loadCookiesFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.cookies) != 2 {
+		t.Fatalf("loaded %d cookies, want sid and pref", len(loaded.cookies))
+	}
+	for key, want := range s.cookies {
+		got := loaded.cookies[key]
+		if got == nil {
+			t.Errorf("cookie %s was not saved", key)
+			continue
+		}
+		if got.domain != want.domain || got.hostOnly != want.hostOnly || got.path != want.path || got.secure != want.secure ||
+			got.httpOnly != want.httpOnly || got.value != want.value || got.expires.Unix() != want.expires.Unix() || got.created != want.created {
+			t.Errorf("cookie %s = %+v, want %+v", key, got, want)
+		}
+	}
+	if sid := loaded.cookies["www.example.onion;/board;sid"]; sid == nil || !sid.hostOnly || !sid.expires.IsZero() {
+		t.Errorf("sid = %+v, want a host-only session cookie with the request's directory as path", sid)
+	}
+}
+
+func TestCookiesFor(t *testing.T) {
+	s := &session{name: "test", cookies: make(map[string]*sessionCookie)}
+	now := time.Now()
+	for _, cookie := range []*sessionCookie{
+		{domain: "example.onion", path: "/", name: "wide", value: "1"},
+		{domain: "www.example.onion", hostOnly: true, path: "/forum", name: "forum", value: "2"},
+		{domain: "example.onion", path: "/forum/thread", name: "thread", value: "3"},
+		{domain: "example.onion", path: "/", secure: true, name: "secure", value: "4"},
+		{domain: "example.onion", path: "/forums", name: "forums", value: "5"},
+		{domain: "example.onion", path: "/", name: "stale", value: "6", expires: now.Add(time.Hour)},
+		{domain: "example.com", path: "/", secure: true, name: "clearnet", value: "7"},
+	} {
+		s.store(cookie, now)
+	}
+	s.cookies["example.onion;/;stale"].expires = now.Add(-time.Second)
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"http://www.example.onion/forum/thread/1", "thread forum wide secure"},
+		{"http://forum.example.onion/forum/thread", "thread wide secure"},
+		{"http://www.example.onion/forums/", "forums wide secure"},
+		{"http://example.onion", "wide secure"},
+		{"http://notexample.onion/", ""},
+		{"http://example.com/", ""},
+		{"https://example.com/", "clearnet"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		var names []string
+		for _, cookie := range s.cookiesFor(u) {
+			names = append(names, cookie.Name)
+		}
+		if got := strings.Join(names, " "); got != tt.want {
+			t.Errorf("cookiesFor(%s) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestFindLoginForm(t *testing.T) {
+	content := `<form action="/search"><input name="q"></form>
+<form action="/login" method="post">
+  <input type="hidden" name="csrf" value="tok">
+  <input name="user">
+  <input type="password" name="pass">
+  <input type="checkbox" name="remember" checked>
+  <input type="checkbox" name="newsletter" value="yes">
+  <input type="file" name="avatar">
+  <textarea name="note">hi</textarea>
+  <input type="submit" name="go" value="Log in">
+  <button name="alt" value="other">Other</button>
+</form>`
+	form := findLoginForm(content)
+	if form == nil {
+		t.Fatal("findLoginForm() = nil, want the password form")
+	}
+	if form.action != "/login" || form.method != "POST" {
+		t.Errorf("form = %s %s, want POST /login", form.method, form.action)
+	}
+	want := url.Values{"csrf": {"tok"}, "user": {""}, "pass": {""}, "remember": {"on"}, "note": {"hi"}, "go": {"Log in"}}
+	if form.values.Encode() != want.Encode() {
+		t.Errorf("values = %s, want %s", form.values.Encode(), want.Encode())
+	}
+
+	if form := findLoginForm(`<form action="/a"><input name="x"></form><form action="/b"></form>`); form == nil || form.action != "/a" {
+		t.Errorf("findLoginForm(no password) = %+v, want the first form", form)
+	}
+	if form := findLoginForm(`<p>no forms</p>`); form != nil {
+		t.Errorf("findLoginForm(no forms) = %+v, want nil", form)
+	}
+}
+
+func TestSessionLogin(t *testing.T) {
+	t.Setenv("TEST_FORUM_PASSWORD", "hunter2")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "pre", Value: "1"})
+			w.Write([]byte(`<form action="auth" method="post"><input type="hidden" name="csrf" value="tok">
+<input name="user"><input type="password" name="pass"></form>`))
+		case "/auth":
+			pre, _ := r.Cookie("pre")
+			if r.Method != "POST" || r.Header.Get("Content-Type") != "application/x-www-form-urlencoded" ||
+				r.Header.Get("Referer") != "http://"+r.Host+"/login" || pre == nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			if r.PostFormValue("csrf") != "tok" || r.PostFormValue("user") != "alice" || r.PostFormValue("pass") != "hunter2" {
+				w.Write([]byte("Invalid login"))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "ok", HttpOnly: true})
+			w.Write([]byte("Welcome back, alice"))
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	login := &LoginStep{URL: server.URL + "/login", Fields: map[string]string{"user": "alice", "pass": "${TEST_FORUM_PASSWORD}"}, Success: "welcome back"}
+	config := &YAMLConfig{
+		Targets:  []Target{withCanonicalURL(Target{URL: server.URL + "/", Session: "forum"})},
+		Sessions: map[string]*SessionConfig{"forum": {LoggedOut: "log in", Login: login}},
+	}
+	jar, err := newSessionJar(config, filepath.Join(dir, "targets.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Jar: jar}
+	s := jar.sessions["forum"]
+
+	if err := s.login(client); err != nil {
+		t.Fatalf("login() = %v", err)
+	}
+	u, _ := url.Parse(server.URL + "/")
+	if cookies := jar.Cookies(u); len(cookies) != 2 || cookies[1].Name != "sid" {
+		t.Errorf("cookies after login = %v, want pre and sid", cookies)
+	}
+	jar.save()
+	if info, err := os.Stat(filepath.Join(dir, defaultSessionDir, "forum.cookies.txt")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("saved jar = %v, %v, want a 0600 file", info, err)
+	}
+
+	login.Fields["pass"] = "wrong"
+	if err := s.login(client); err == nil || !strings.Contains(err.Error(), "success marker") {
+		t.Errorf("login(wrong password) = %v, want a missing success marker", err)
+	}
+}
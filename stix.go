@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// stixSCONamespace is the UUIDv5 namespace STIX 2.1 defines for
+	// deterministic cyber observable IDs
+	stixSCONamespace = "00abedb4-aa42-466c-9c01-fed23315a9b7"
+	// scraperNamespace derives the IDs of this tool's own objects, so
+	// re-exporting a scan produces the same IDs
+	scraperNamespace = "4b4c1a3e-8f0d-5c6e-9a51-7d2f3b6e0c19"
+	// stixTimeFormat is the STIX timestamp format with millisecond precision
+	stixTimeFormat = "2006-01-02T15:04:05.000Z"
+)
+
+// STIXBundle is a STIX 2.1 bundle of objects
+type STIXBundle struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Objects []STIXObject `json:"objects"`
+}
+
+// STIXObject holds the properties of every STIX object type the export
+// writes; unused properties are omitted
+type STIXObject struct {
+	Type        string `json:"type"`
+	SpecVersion string `json:"spec_version"`
+	ID          string `json:"id"`
+	Created     string `json:"created,omitempty"`
+	Modified    string `json:"modified,omitempty"`
+
+	Name                string   `json:"name,omitempty"`
+	Description         string   `json:"description,omitempty"`
+	Labels              []string `json:"labels,omitempty"`
+	InfrastructureTypes []string `json:"infrastructure_types,omitempty"`
+
+	// Cyber observables
+	Value string `json:"value,omitempty"`
+
+	// observed-data
+	FirstObserved  string   `json:"first_observed,omitempty"`
+	LastObserved   string   `json:"last_observed,omitempty"`
+	NumberObserved int      `json:"number_observed,omitempty"`
+	ObjectRefs     []string `json:"object_refs,omitempty"`
+
+	// indicator
+	IndicatorTypes []string `json:"indicator_types,omitempty"`
+	Pattern        string   `json:"pattern,omitempty"`
+	PatternType    string   `json:"pattern_type,omitempty"`
+	ValidFrom      string   `json:"valid_from,omitempty"`
+
+	// relationship
+	RelationshipType string `json:"relationship_type,omitempty"`
+	SourceRef        string `json:"source_ref,omitempty"`
+	TargetRef        string `json:"target_ref,omitempty"`
+}
+
+// uuidV5 returns the name-based SHA-1 UUID of name in the namespace
+func uuidV5(namespace, name string) string {
+	ns, _ := hex.DecodeString(strings.ReplaceAll(namespace, "-", ""))
+	h := sha1.New()
+	h.Write(ns)
+	h.Write([]byte(name))
+	sum := h.Sum(nil)[:16]
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	s := hex.EncodeToString(sum)
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// stixObservableID returns the deterministic ID of a cyber observable from
+// its canonical {"value": ...} JSON, as the STIX 2.1 spec recommends
+func stixObservableID(objectType, value string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(map[string]string{"value": value})
+	return objectType + "--" + uuidV5(stixSCONamespace, strings.TrimSuffix(buf.String(), "\n"))
+}
+
+// stixID returns a deterministic ID for one of this tool's domain objects
+func stixID(objectType string, parts ...string) string {
+	return objectType + "--" + uuidV5(scraperNamespace, objectType+"|"+strings.Join(parts, "|"))
+}
+
+// stixTime formats a timestamp for STIX
+func stixTime(t time.Time) string {
+	return t.UTC().Format(stixTimeFormat)
+}
+
+// stixString quotes a value for use in a STIX pattern
+func stixString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// iocPattern returns the STIX pattern of an indicator, or "" for types that
+// are not exported as indicators
+func iocPattern(ioc ReportIOC) string {
+	value := stixString(ioc.Value)
+	switch ioc.Type {
+	case IOCEmail:
+		return "[email-addr:value = " + value + "]"
+	case IOCDomain:
+		return "[domain-name:value = " + value + "]"
+	case IOCIPv4:
+		return "[ipv4-addr:value = " + value + "]"
+	case IOCIPv6:
+		return "[ipv6-addr:value = " + value + "]"
+	case IOCMD5:
+		return "[file:hashes.MD5 = " + value + "]"
+	case IOCSHA1:
+		return "[file:hashes.'SHA-1' = " + value + "]"
+	case IOCSHA256:
+		return "[file:hashes.'SHA-256' = " + value + "]"
+	case IOCBitcoin, IOCMonero, IOCEthereum:
+		return "[x-cryptocurrency-wallet:address = " + value + " AND x-cryptocurrency-wallet:currency = " + stixString(ioc.Type) + "]"
+	case IOCTelegram, IOCJabber, IOCTox:
+		return "[user-account:account_type = " + stixString(ioc.Type) + " AND user-account:account_login = " + value + "]"
+	case IOCPGPFingerprint:
+		return "[x-pgp-key:fingerprint = " + value + "]"
+	}
+	return ""
+}
+
+// buildSTIXBundle converts a scan report into a STIX 2.1 bundle. Every
+// scanned URL becomes an infrastructure object made of url and domain-name
+// observables, with observed-data covering when it was checked, and every
+// extracted indicator an indicator pointing at the pages it was found on.
+func buildSTIXBundle(report ScanReport) STIXBundle {
+	var objects []STIXObject
+	modified := stixTime(report.EndTime)
+
+	type observation struct {
+		first, last time.Time
+		count       int
+		result      ScanResult
+	}
+	observed := make(map[string]*observation)
+	var order []string
+	for _, result := range report.Results {
+		// The canonical URL always has a scheme and host, unlike a bare
+		// "abc.onion" from a targets list
+		key := resultKey(result)
+		obs, ok := observed[key]
+		if !ok {
+			obs = &observation{first: result.Timestamp, last: result.Timestamp, result: result}
+			observed[key] = obs
+			order = append(order, key)
+		}
+		if result.Timestamp.Before(obs.first) {
+			obs.first = result.Timestamp
+		}
+		if result.Timestamp.After(obs.last) {
+			obs.last = result.Timestamp
+		}
+		obs.count++
+	}
+
+	infrastructure := make(map[string]string)
+	for _, rawURL := range order {
+		obs := observed[rawURL]
+		result := obs.result
+		created := stixTime(obs.first)
+
+		urlObject := STIXObject{Type: "url", SpecVersion: "2.1", ID: stixObservableID("url", rawURL), Value: rawURL}
+		objects = append(objects, urlObject)
+		refs := []string{urlObject.ID}
+		if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+			domain := STIXObject{Type: "domain-name", SpecVersion: "2.1", ID: stixObservableID("domain-name", u.Hostname()), Value: u.Hostname()}
+			objects = append(objects, domain)
+			refs = append(refs, domain.ID)
+		}
+
+		name := result.Name
+		if name == "" {
+			name = rawURL
+		}
+		var labels []string
+		for _, label := range []string{result.Type, result.Name} {
+			if label != "" {
+				labels = append(labels, label)
+			}
+		}
+		description := fmt.Sprintf("Status: %s", result.Status)
+		if result.StatusCode > 0 {
+			description += fmt.Sprintf(" (HTTP %d)", result.StatusCode)
+		}
+		if result.Title != "" {
+			description += "\nTitle: " + result.Title
+		}
+
+		infra := STIXObject{
+			Type: "infrastructure", SpecVersion: "2.1", ID: stixID("infrastructure", rawURL),
+			Created: created, Modified: modified,
+			Name: name, Description: description, Labels: labels,
+			InfrastructureTypes: []string{"unknown"},
+		}
+		infrastructure[rawURL] = infra.ID
+		objects = append(objects, infra)
+
+		for _, ref := range refs {
+			objects = append(objects, STIXObject{
+				Type: "relationship", SpecVersion: "2.1", ID: stixID("relationship", infra.ID, "consists-of", ref),
+				Created: created, Modified: modified,
+				RelationshipType: "consists-of", SourceRef: infra.ID, TargetRef: ref,
+			})
+		}
+
+		objects = append(objects, STIXObject{
+			Type: "observed-data", SpecVersion: "2.1", ID: stixID("observed-data", rawURL, stixTime(report.StartTime)),
+			Created: modified, Modified: modified,
+			FirstObserved: stixTime(obs.first), LastObserved: stixTime(obs.last),
+			NumberObserved: obs.count, ObjectRefs: refs,
+		})
+	}
+
+	for _, ioc := range report.IOCs {
+		pattern := iocPattern(ioc)
+		if pattern == "" {
+			continue
+		}
+		indicator := STIXObject{
+			Type: "indicator", SpecVersion: "2.1", ID: stixID("indicator", ioc.Type, ioc.Value),
+			Created: stixTime(report.StartTime), Modified: modified,
+			Name: ioc.Type + ": " + ioc.Value, Labels: []string{ioc.Type},
+			IndicatorTypes: []string{"attribution"},
+			Pattern:        pattern, PatternType: "stix", ValidFrom: stixTime(report.StartTime),
+		}
+		objects = append(objects, indicator)
+
+		for _, pageURL := range ioc.URLs {
+			if infraID, ok := infrastructure[pageURL]; ok {
+				objects = append(objects, STIXObject{
+					Type: "relationship", SpecVersion: "2.1", ID: stixID("relationship", indicator.ID, "indicates", infraID),
+					Created: indicator.Created, Modified: modified,
+					RelationshipType: "indicates", SourceRef: indicator.ID, TargetRef: infraID,
+				})
+			}
+		}
+	}
+
+	return STIXBundle{
+		Type:    "bundle",
+		ID:      stixID("bundle", stixTime(report.StartTime)),
+		Objects: dedupeSTIXObjects(objects),
+	}
+}
+
+// dedupeSTIXObjects drops repeated objects, such as a domain shared by
+// several URLs, keeping the first
+func dedupeSTIXObjects(objects []STIXObject) []STIXObject {
+	seen := make(map[string]bool)
+	unique := objects[:0]
+	for _, object := range objects {
+		if !seen[object.ID] {
+			seen[object.ID] = true
+			unique = append(unique, object)
+		}
+	}
+	return unique
+}
+
+// writeSTIXBundle saves a scan report as a STIX 2.1 bundle
+func writeSTIXBundle(report ScanReport, path string) error {
+	data, err := json.MarshalIndent(buildSTIXBundle(report), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal STIX bundle: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write STIX bundle: %w", err)
+	}
+	return nil
+}
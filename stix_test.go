@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// stixSchemaBase is the $id prefix of the STIX 2.1 schemas in testdata
+const stixSchemaBase = "http://raw.githubusercontent.com/oasis-open/cti-stix2-json-schemas/stix2.1/schemas/"
+
+// loadFixtureReport reads the test report and collects its indicators the
+// way analyzeReport does
+func loadFixtureReport(t *testing.T) ScanReport {
+	t.Helper()
+	report, err := loadScanReport(filepath.Join("testdata", "report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report.IOCs = collectIOCs(report.Results)
+	return *report
+}
+
+// stixSchemaCompiler resolves the schema URLs to the copies in testdata
+func stixSchemaCompiler() *jsonschema.Compiler {
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(s string) (io.ReadCloser, error) {
+		if rel, ok := strings.CutPrefix(s, stixSchemaBase); ok {
+			return os.Open(filepath.Join("testdata", "stix2.1", "schemas", filepath.FromSlash(rel)))
+		}
+		return jsonschema.LoadURL(s)
+	}
+	return compiler
+}
+
+// stixObjectSchema returns the schema of a STIX object type
+func stixObjectSchema(objectType string) string {
+	switch objectType {
+	case "url", "domain-name":
+		return stixSchemaBase + "observables/" + objectType + ".json"
+	case "relationship":
+		return stixSchemaBase + "sros/" + objectType + ".json"
+	}
+	return stixSchemaBase + "sdos/" + objectType + ".json"
+}
+
+func TestSTIXBundleValidatesAgainstSchema(t *testing.T) {
+	bundle := buildSTIXBundle(loadFixtureReport(t))
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	compiler := stixSchemaCompiler()
+	schema, err := compiler.Compile(stixSchemaBase + "common/bundle.json")
+	if err != nil {
+		t.Fatalf("failed to compile bundle schema: %v", err)
+	}
+	if err := schema.Validate(doc); err != nil {
+		t.Fatalf("bundle does not validate: %#v", err)
+	}
+
+	// The bundle schema only checks the core properties of types it does not
+	// list, such as infrastructure, so each object is checked on its own too
+	types := make(map[string]int)
+	for _, object := range doc["objects"].([]interface{}) {
+		objectType := object.(map[string]interface{})["type"].(string)
+		types[objectType]++
+		schema, err := compiler.Compile(stixObjectSchema(objectType))
+		if err != nil {
+			t.Fatalf("failed to compile %s schema: %v", objectType, err)
+		}
+		if err := schema.Validate(object); err != nil {
+			t.Errorf("%s does not validate: %#v", object.(map[string]interface{})["id"], err)
+		}
+	}
+	for _, objectType := range []string{"url", "domain-name", "infrastructure", "observed-data", "indicator", "relationship"} {
+		if types[objectType] == 0 {
+			t.Errorf("bundle has no %s objects", objectType)
+		}
+	}
+}
+
+func TestSTIXBundleUsesCanonicalURL(t *testing.T) {
+	bundle := buildSTIXBundle(loadFixtureReport(t))
+	values := make(map[string]bool)
+	indicates := 0
+	for _, object := range bundle.Objects {
+		if object.Value != "" {
+			values[object.Type+" "+object.Value] = true
+		}
+		if object.RelationshipType == "indicates" {
+			indicates++
+		}
+	}
+	for _, want := range []string{"url http://abc.onion/", "domain-name abc.onion", "domain-name market.example.onion"} {
+		if !values[want] {
+			t.Errorf("bundle has no %s object", want)
+		}
+	}
+	if values["url abc.onion"] {
+		t.Errorf("bundle has a url object without a scheme")
+	}
+	// Every exported indicator links to the infrastructure of its pages
+	if indicates == 0 {
+		t.Errorf("bundle has no indicates relationships")
+	}
+}
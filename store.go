@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// databaseFileName is the results database kept in the output directory
+const databaseFileName = "scans.db"
+
+// Bucket names in the results database. Results are stored in one nested
+// bucket per run, keyed by canonical URL.
+var (
+	targetsBucket = []byte("targets")
+	runsBucket    = []byte("runs")
+	resultsBucket = []byte("results")
+)
+
+// StoredTarget is a target as recorded in the database
+type StoredTarget struct {
+	URL       string    `json:"url"`
+	Name      string    `json:"name,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// RunRecord summarizes a single scan run
+type RunRecord struct {
+	ID         uint64    `json:"id"`
+	StartTime  time.Time `json:"start_time"`
+	EndTime    time.Time `json:"end_time"`
+	TotalURLs  int       `json:"total_urls"`
+	Successful int       `json:"successful"`
+	Failed     int       `json:"failed"`
+	OutputDir  string    `json:"output_dir,omitempty"`
+}
+
+// StoredResult is a scan result as recorded in the database. Page content
+// stays in the report files; only its size and hash are kept.
+type StoredResult struct {
+	RunID        uint64    `json:"run_id"`
+	URL          string    `json:"url"`
+	CanonicalURL string    `json:"canonical_url"`
+	Name         string    `json:"name,omitempty"`
+	Type         string    `json:"type,omitempty"`
+	Title        string    `json:"title,omitempty"`
+	Status       string    `json:"status"`
+	StatusCode   int       `json:"status_code"`
+	Error        string    `json:"error,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+	LatencyMS    int64     `json:"latency_ms"`
+	ContentSize  int       `json:"content_size"`
+	ContentHash  string    `json:"content_hash,omitempty"`
+}
+
+// openDatabase opens (creating if needed) the results database
+func openDatabase(path string, readOnly bool) (*bolt.DB, error) {
+	if !readOnly {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	} else if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: 10 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// runKey encodes a run ID so keys sort in run order
+func runKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+// recordRun stores a finished scan in the results database and returns the run ID
+func recordRun(dbPath string, report ScanReport, outputDir string) (uint64, error) {
+	db, err := openDatabase(dbPath, false)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var runID uint64
+	err = db.Update(func(tx *bolt.Tx) error {
+		targets, err := tx.CreateBucketIfNotExists(targetsBucket)
+		if err != nil {
+			return err
+		}
+		runs, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		results, err := tx.CreateBucketIfNotExists(resultsBucket)
+		if err != nil {
+			return err
+		}
+
+		runID, err = runs.NextSequence()
+		if err != nil {
+			return err
+		}
+		run := RunRecord{
+			ID:         runID,
+			StartTime:  report.StartTime,
+			EndTime:    report.EndTime,
+			TotalURLs:  report.TotalURLs,
+			Successful: report.Successful,
+			Failed:     report.Failed,
+			OutputDir:  outputDir,
+		}
+		if err := putJSON(runs, runKey(runID), run); err != nil {
+			return err
+		}
+
+		runResults, err := results.CreateBucket(runKey(runID))
+		if err != nil {
+			return err
+		}
+		for _, result := range report.Results {
+			key := resultKey(result)
+			stored := StoredResult{
+				RunID:        runID,
+				URL:          result.URL,
+				CanonicalURL: key,
+				Name:         result.Name,
+				Type:         result.Type,
+				Title:        result.Title,
+				Status:       result.Status,
+				StatusCode:   result.StatusCode,
+				Error:        result.Error,
+				Timestamp:    result.Timestamp,
+				LatencyMS:    result.LatencyMS,
+				ContentSize:  len(result.Content),
+			}
+			if hasContent(result) {
+				stored.ContentHash = contentHash(result.Content)
+			}
+			if err := putJSON(runResults, []byte(key), stored); err != nil {
+				return err
+			}
+
+			target := StoredTarget{URL: key, FirstSeen: result.Timestamp}
+			if existing := targets.Get([]byte(key)); existing != nil {
+				if err := json.Unmarshal(existing, &target); err != nil {
+					return fmt.Errorf("corrupt target record %s: %w", key, err)
+				}
+			}
+			if result.Name != "" {
+				target.Name = result.Name
+			}
+			if result.Type != "" {
+				target.Type = result.Type
+			}
+			target.LastSeen = result.Timestamp
+			if err := putJSON(targets, []byte(key), target); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to record run: %w", err)
+	}
+	return runID, nil
+}
+
+// saveToDatabase records the report and logs the outcome; a database
+// failure never fails the scan itself
+func saveToDatabase(report ScanReport, dbPath, outputDir string) {
+	runID, err := recordRun(dbPath, report, outputDir)
+	if err != nil {
+		fmt.Printf("[WARN] %v\n", err)
+		return
+	}
+	fmt.Printf("[INFO] 🗄️  Run #%d recorded in: %s\n", runID, dbPath)
+}
+
+// putJSON stores value as JSON under key
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// listRuns returns all runs in order
+func listRuns(db *bolt.DB) ([]RunRecord, error) {
+	var runs []RunRecord
+	err := db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(runsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var run RunRecord
+			if err := json.Unmarshal(v, &run); err != nil {
+				return fmt.Errorf("corrupt run record: %w", err)
+			}
+			runs = append(runs, run)
+			return nil
+		})
+	})
+	return runs, err
+}
+
+// resultFilter selects stored results
+type resultFilter struct {
+	URL    string
+	Status string
+	Type   string
+	RunID  uint64
+	Since  time.Time
+	Until  time.Time
+}
+
+// matches reports whether a stored result passes the filter
+func (f resultFilter) matches(result StoredResult) bool {
+	if f.URL != "" && result.CanonicalURL != f.URL {
+		return false
+	}
+	if f.Status != "" && !strings.EqualFold(result.Status, f.Status) {
+		return false
+	}
+	if f.Type != "" && result.Type != f.Type {
+		return false
+	}
+	if f.RunID != 0 && result.RunID != f.RunID {
+		return false
+	}
+	if !f.Since.IsZero() && result.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !result.Timestamp.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// queryResults returns stored results matching the filter in run order
+func queryResults(db *bolt.DB, filter resultFilter) ([]StoredResult, error) {
+	var matched []StoredResult
+	err := db.View(func(tx *bolt.Tx) error {
+		results := tx.Bucket(resultsBucket)
+		if results == nil {
+			return nil
+		}
+		return results.ForEach(func(runID, _ []byte) error {
+			runResults := results.Bucket(runID)
+			if runResults == nil {
+				return nil
+			}
+			if filter.RunID != 0 && binary.BigEndian.Uint64(runID) != filter.RunID {
+				return nil
+			}
+
+			collect := func(v []byte) error {
+				var result StoredResult
+				if err := json.Unmarshal(v, &result); err != nil {
+					return fmt.Errorf("corrupt result record: %w", err)
+				}
+				if filter.matches(result) {
+					matched = append(matched, result)
+				}
+				return nil
+			}
+			// A target's history only needs one lookup per run
+			if filter.URL != "" {
+				if v := runResults.Get([]byte(filter.URL)); v != nil {
+					return collect(v)
+				}
+				return nil
+			}
+			return runResults.ForEach(func(_, v []byte) error { return collect(v) })
+		})
+	})
+	return matched, err
+}
+
+// parseQueryTime accepts a date (2006-01-02) or an RFC 3339 timestamp
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD or RFC 3339)", value)
+	}
+	return t, nil
+}
+
+// runQuery implements the query subcommand
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	dbPath := fs.String("db", filepath.Join("output", databaseFileName), "results database")
+	format := fs.String("format", "table", "output format: table or json")
+	fs.Usage = func() {
+		fmt.Println("Usage: tor-scraper query [-db path] [-format table|json] <command> [flags]")
+		fmt.Println()
+		fmt.Println("Commands:")
+		fmt.Println("  runs                       list all scan runs")
+		fmt.Println("  target <url>               show the history of one target")
+		fmt.Println("  results [flags]            filter results (-status, -type, -run, -since, -until)")
+		fmt.Println()
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("missing query command")
+	}
+
+	db, err := openDatabase(*dbPath, true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	command, rest := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "runs":
+		runs, err := listRuns(db)
+		if err != nil {
+			return err
+		}
+		if *format == "json" {
+			return printJSON(runs)
+		}
+		printRunsTable(runs)
+		return nil
+
+	case "target":
+		if len(rest) < 1 {
+			return fmt.Errorf("usage: tor-scraper query target <url>")
+		}
+		url, err := normalizeURL(rest[0])
+		if err != nil {
+			return err
+		}
+		results, err := queryResults(db, resultFilter{URL: url})
+		if err != nil {
+			return err
+		}
+		if *format == "json" {
+			return printJSON(results)
+		}
+		printResultsTable(results)
+		return nil
+
+	case "results":
+		rfs := flag.NewFlagSet("query results", flag.ExitOnError)
+		status := rfs.String("status", "", "only results with this status (e.g. SUCCESS, FAILED)")
+		targetType := rfs.String("type", "", "only targets of this type")
+		runID := rfs.Uint64("run", 0, "only results from this run ID")
+		since := rfs.String("since", "", "only results at or after this date")
+		until := rfs.String("until", "", "only results before this date")
+		rfs.Parse(rest)
+
+		filter := resultFilter{Status: *status, Type: *targetType, RunID: *runID}
+		if filter.Since, err = parseQueryTime(*since); err != nil {
+			return err
+		}
+		if filter.Until, err = parseQueryTime(*until); err != nil {
+			return err
+		}
+		results, err := queryResults(db, filter)
+		if err != nil {
+			return err
+		}
+		if *format == "json" {
+			return printJSON(results)
+		}
+		printResultsTable(results)
+		return nil
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown query command %q", command)
+	}
+}
+
+// printJSON writes value to stdout as indented JSON
+func printJSON(value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// printRunsTable writes runs as an aligned table
+func printRunsTable(runs []RunRecord) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tSTART\tDURATION\tTOTAL\tSUCCESS\tFAILED\tOUTPUT")
+	for _, run := range runs {
+		fmt.Fprintf(w, "%d\t%s\t%v\t%d\t%d\t%d\t%s\n",
+			run.ID, run.StartTime.Format("2006-01-02 15:04:05"),
+			run.EndTime.Sub(run.StartTime).Round(time.Second),
+			run.TotalURLs, run.Successful, run.Failed, run.OutputDir)
+	}
+	w.Flush()
+}
+
+// printResultsTable writes stored results as an aligned table
+func printResultsTable(results []StoredResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN\tTIMESTAMP\tURL\tTYPE\tSTATUS\tCODE\tLATENCY\tSIZE")
+	for _, result := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%d\t%dms\t%d\n",
+			result.RunID, result.Timestamp.Format("2006-01-02 15:04:05"),
+			result.CanonicalURL, result.Type, result.Status, result.StatusCode,
+			result.LatencyMS, result.ContentSize)
+	}
+	w.Flush()
+}
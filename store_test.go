@@ -0,0 +1,128 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// storeFixture records two runs: a.onion up then down, b.onion up once
+func storeFixture(t *testing.T) (string, time.Time) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), databaseFileName)
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	first := ScanReport{
+		StartTime: start, EndTime: start.Add(time.Minute), TotalURLs: 2, Successful: 2,
+		Results: []ScanResult{
+			{URL: "abc.onion", CanonicalURL: "http://a.onion/", Name: "Forum", Type: "forum", Status: "SUCCESS", StatusCode: 200, Content: "hello", Timestamp: start},
+			{URL: "http://b.onion/", Type: "market", Status: "SUCCESS", StatusCode: 200, Content: "shop", Timestamp: start},
+		},
+	}
+	second := ScanReport{
+		StartTime: start.Add(24 * time.Hour), EndTime: start.Add(24*time.Hour + time.Minute), TotalURLs: 1, Failed: 1,
+		Results: []ScanResult{
+			{URL: "abc.onion", CanonicalURL: "http://a.onion/", Status: "FAILED", Error: "timeout", Timestamp: start.Add(24 * time.Hour)},
+		},
+	}
+	for i, report := range []ScanReport{first, second} {
+		id, err := recordRun(dbPath, report, "output/run")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != uint64(i+1) {
+			t.Errorf("run ID = %d, want %d", id, i+1)
+		}
+	}
+	return dbPath, start
+}
+
+func TestRecordRun(t *testing.T) {
+	dbPath, start := storeFixture(t)
+	db, err := openDatabase(dbPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	runs, err := listRuns(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].TotalURLs != 2 || runs[1].Failed != 1 || runs[0].OutputDir != "output/run" {
+		t.Errorf("runs = %+v", runs)
+	}
+
+	history, err := queryResults(db, resultFilter{URL: "http://a.onion/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].RunID != 1 || history[1].Status != "FAILED" {
+		t.Fatalf("a.onion history = %+v, want SUCCESS then FAILED", history)
+	}
+	if history[0].URL != "abc.onion" || history[0].ContentSize != 5 || history[0].ContentHash != contentHash("hello") {
+		t.Errorf("first result = %+v, want the URL as written and the content size and hash", history[0])
+	}
+	if history[1].ContentHash != "" {
+		t.Errorf("failed result has content hash %q", history[1].ContentHash)
+	}
+	if !history[1].Timestamp.Equal(start.Add(24 * time.Hour)) {
+		t.Errorf("second timestamp = %v", history[1].Timestamp)
+	}
+}
+
+func TestQueryResultsFilters(t *testing.T) {
+	dbPath, start := storeFixture(t)
+	db, err := openDatabase(dbPath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name   string
+		filter resultFilter
+		want   int
+	}{
+		{"all", resultFilter{}, 3},
+		{"url", resultFilter{URL: "http://b.onion/"}, 1},
+		{"unknown url", resultFilter{URL: "http://c.onion/"}, 0},
+		{"status is case-insensitive", resultFilter{Status: "success"}, 2},
+		{"type", resultFilter{Type: "forum"}, 1},
+		{"run", resultFilter{RunID: 2}, 1},
+		{"since", resultFilter{Since: start.Add(time.Hour)}, 1},
+		{"until is exclusive", resultFilter{Until: start}, 0},
+		{"until", resultFilter{Until: start.Add(time.Hour)}, 2},
+		{"combined", resultFilter{URL: "http://a.onion/", Status: "FAILED", RunID: 2}, 1},
+	}
+	for _, tt := range tests {
+		got, err := queryResults(db, tt.filter)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(got) != tt.want {
+			t.Errorf("%s: got %d results, want %d", tt.name, len(got), tt.want)
+		}
+	}
+}
+
+func TestOpenDatabaseReadOnlyMissing(t *testing.T) {
+	if _, err := openDatabase(filepath.Join(t.TempDir(), "missing.db"), true); err == nil {
+		t.Errorf("openDatabase(missing, read-only) succeeded, want an error")
+	}
+}
+
+func TestParseQueryTime(t *testing.T) {
+	if got, err := parseQueryTime(""); err != nil || !got.IsZero() {
+		t.Errorf("parseQueryTime(\"\") = %v, %v", got, err)
+	}
+	if got, err := parseQueryTime("2026-10-01"); err != nil || got.Day() != 1 {
+		t.Errorf("parseQueryTime(date) = %v, %v", got, err)
+	}
+	if got, err := parseQueryTime("2026-10-01T12:00:00Z"); err != nil || got.Hour() != 12 {
+		t.Errorf("parseQueryTime(RFC 3339) = %v, %v", got, err)
+	}
+	if _, err := parseQueryTime("yesterday"); err == nil {
+		t.Errorf("parseQueryTime(yesterday) succeeded, want an error")
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultTechnologies are the built-in rules used when the targets file does
+// not name a rules file
+//
+//go:embed technologies.yaml
+var defaultTechnologies []byte
+
+// patternList is a rule field that may be a single pattern or a list
+type patternList []string
+
+// UnmarshalYAML accepts a scalar or a sequence
+func (p *patternList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*p = patternList{value.Value}
+		return nil
+	}
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// TechRule describes how to recognize one technology, in the style of
+// Wappalyzer's technology files. Patterns are regexes that may carry
+// "\;version:\1" and "\;confidence:50" suffixes.
+type TechRule struct {
+	Category  string                 `yaml:"category,omitempty"`
+	Cats      []int                  `yaml:"cats,omitempty"`
+	Headers   map[string]patternList `yaml:"headers,omitempty"`
+	Cookies   map[string]patternList `yaml:"cookies,omitempty"`
+	Meta      map[string]patternList `yaml:"meta,omitempty"`
+	HTML      patternList            `yaml:"html,omitempty"`
+	ScriptSrc patternList            `yaml:"scriptSrc,omitempty"`
+	URL       patternList            `yaml:"url,omitempty"`
+	Implies   patternList            `yaml:"implies,omitempty"`
+}
+
+// techPattern is a compiled rule pattern
+type techPattern struct {
+	re         *regexp.Regexp
+	version    string
+	confidence int
+}
+
+// compiledTech is a rule with its patterns compiled
+type compiledTech struct {
+	name      string
+	category  string
+	headers   map[string][]techPattern
+	cookies   map[string][]techPattern
+	meta      map[string][]techPattern
+	html      []techPattern
+	scriptSrc []techPattern
+	url       []techPattern
+	implies   []impliedTech
+}
+
+// impliedTech is a technology implied by another, with the confidence given
+// by its "\;confidence:50" suffix
+type impliedTech struct {
+	name       string
+	confidence int
+}
+
+// TechRules is a loaded technology rules file
+type TechRules struct {
+	techs []*compiledTech
+	index map[string]*compiledTech
+}
+
+// DetectedTech is a technology found on a page
+type DetectedTech struct {
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"`
+	Category   string `json:"category,omitempty"`
+	Confidence int    `json:"confidence"`
+}
+
+// TechnologyUsage rolls up one technology across the report
+type TechnologyUsage struct {
+	Name     string   `json:"name"`
+	Category string   `json:"category,omitempty"`
+	Versions []string `json:"versions,omitempty"`
+	Count    int      `json:"count"`
+	URLs     []string `json:"urls"`
+}
+
+// loadTechRules reads a technology rules file, or the built-in rules when
+// path is empty. The technologies may sit under a "technologies" key or at
+// the top level, as in Wappalyzer's files.
+func loadTechRules(path string) (*TechRules, error) {
+	data := defaultTechnologies
+	if path != "" {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read technology rules: %w", err)
+		}
+	}
+
+	var file struct {
+		Technologies map[string]TechRule `yaml:"technologies"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil || len(file.Technologies) == 0 {
+		if err := yaml.Unmarshal(data, &file.Technologies); err != nil {
+			return nil, fmt.Errorf("failed to parse technology rules %s: %w", path, err)
+		}
+	}
+
+	rules := &TechRules{index: make(map[string]*compiledTech)}
+	for name, rule := range file.Technologies {
+		tech, err := compileTechRule(name, rule)
+		if err != nil {
+			return nil, err
+		}
+		rules.techs = append(rules.techs, tech)
+		rules.index[name] = tech
+	}
+	sort.Slice(rules.techs, func(i, j int) bool { return rules.techs[i].name < rules.techs[j].name })
+	return rules, nil
+}
+
+// compileTechRule compiles the patterns of one rule
+func compileTechRule(name string, rule TechRule) (*compiledTech, error) {
+	tech := &compiledTech{name: name, category: rule.Category}
+	for _, raw := range rule.Implies {
+		tech.implies = append(tech.implies, parseImpliedTech(raw))
+	}
+	var err error
+	compileMap := func(patterns map[string]patternList) map[string][]techPattern {
+		compiled := make(map[string][]techPattern)
+		for key, list := range patterns {
+			for _, raw := range list {
+				pattern, perr := compileTechPattern(raw)
+				if perr != nil && err == nil {
+					err = fmt.Errorf("technology %s: %w", name, perr)
+				}
+				compiled[strings.ToLower(key)] = append(compiled[strings.ToLower(key)], pattern)
+			}
+		}
+		return compiled
+	}
+	compileList := func(list patternList) []techPattern {
+		var compiled []techPattern
+		for _, raw := range list {
+			pattern, perr := compileTechPattern(raw)
+			if perr != nil && err == nil {
+				err = fmt.Errorf("technology %s: %w", name, perr)
+			}
+			compiled = append(compiled, pattern)
+		}
+		return compiled
+	}
+
+	tech.headers = compileMap(rule.Headers)
+	tech.cookies = compileMap(rule.Cookies)
+	tech.meta = compileMap(rule.Meta)
+	tech.html = compileList(rule.HTML)
+	tech.scriptSrc = compileList(rule.ScriptSrc)
+	tech.url = compileList(rule.URL)
+	return tech, err
+}
+
+// compileTechPattern splits the "\;" options off a pattern and compiles it
+// case-insensitively. An empty pattern matches any value.
+func compileTechPattern(raw string) (techPattern, error) {
+	parts := strings.Split(raw, `\;`)
+	pattern := techPattern{confidence: 100}
+	for _, option := range parts[1:] {
+		key, value, _ := strings.Cut(option, ":")
+		switch key {
+		case "version":
+			pattern.version = value
+		case "confidence":
+			if n, err := strconv.Atoi(value); err == nil {
+				pattern.confidence = n
+			}
+		}
+	}
+	re, err := regexp.Compile("(?i)" + parts[0])
+	if err != nil {
+		return pattern, fmt.Errorf("invalid pattern %q: %w", parts[0], err)
+	}
+	pattern.re = re
+	return pattern, nil
+}
+
+// parseImpliedTech splits the "\;confidence" option off an implied
+// technology name; the name itself is not a regex
+func parseImpliedTech(raw string) impliedTech {
+	parts := strings.Split(raw, `\;`)
+	implied := impliedTech{name: strings.TrimSpace(parts[0]), confidence: 100}
+	for _, option := range parts[1:] {
+		if key, value, _ := strings.Cut(option, ":"); key == "confidence" {
+			if n, err := strconv.Atoi(value); err == nil {
+				implied.confidence = n
+			}
+		}
+	}
+	return implied
+}
+
+// techGroupRef matches a "\1" group reference, with an optional "?a:b" ternary
+var techGroupRef = regexp.MustCompile(`\\(\d)(?:\?([^:]*):(.*))?`)
+
+// match reports whether the pattern matches and the version it extracts
+func (p techPattern) match(value string) (bool, string) {
+	groups := p.re.FindStringSubmatch(value)
+	if groups == nil {
+		return false, ""
+	}
+	version := techGroupRef.ReplaceAllStringFunc(p.version, func(ref string) string {
+		parts := techGroupRef.FindStringSubmatch(ref)
+		n, _ := strconv.Atoi(parts[1])
+		group := ""
+		if n < len(groups) {
+			group = groups[n]
+		}
+		if strings.Contains(ref, "?") {
+			if group != "" {
+				return parts[2]
+			}
+			return parts[3]
+		}
+		return group
+	})
+	return true, strings.TrimSpace(version)
+}
+
+// pageSignals are the parts of a response the rules look at
+type pageSignals struct {
+	headers   http.Header
+	cookies   map[string]string
+	meta      map[string]string
+	scriptSrc []string
+	content   string
+	url       string
+}
+
+// collectPageSignals gathers the cookies, meta tags and script sources of a result
+func collectPageSignals(result ScanResult) pageSignals {
+	signals := pageSignals{
+		headers: result.Headers,
+		cookies: make(map[string]string),
+		meta:    make(map[string]string),
+		content: result.Content,
+		url:     resultKey(result),
+	}
+	for _, cookie := range (&http.Response{Header: result.Headers}).Cookies() {
+		signals.cookies[strings.ToLower(cookie.Name)] = cookie.Value
+	}
+
+	if !isHTMLContent(result.ContentType) {
+		return signals
+	}
+	doc, err := html.Parse(strings.NewReader(result.Content))
+	if err != nil {
+		return signals
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "meta":
+				name := htmlAttr(n, "name")
+				if name == "" {
+					name = htmlAttr(n, "property")
+				}
+				if name != "" {
+					signals.meta[strings.ToLower(name)] = htmlAttr(n, "content")
+				}
+			case "script":
+				if src := htmlAttr(n, "src"); src != "" {
+					signals.scriptSrc = append(signals.scriptSrc, src)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return signals
+}
+
+// detectTechnologies runs the rules over a result's headers and body
+func detectTechnologies(rules *TechRules, result ScanResult) []DetectedTech {
+	if rules == nil || result.Status != "SUCCESS" {
+		return nil
+	}
+	signals := collectPageSignals(result)
+
+	found := make(map[string]*DetectedTech)
+	record := func(tech *compiledTech, version string, confidence int) {
+		detected, ok := found[tech.name]
+		if !ok {
+			detected = &DetectedTech{Name: tech.name, Category: tech.category}
+			found[tech.name] = detected
+		}
+		detected.Confidence += confidence
+		if detected.Confidence > 100 {
+			detected.Confidence = 100
+		}
+		if len(version) > len(detected.Version) {
+			detected.Version = version
+		}
+	}
+	try := func(tech *compiledTech, patterns []techPattern, values ...string) {
+		for _, pattern := range patterns {
+			for _, value := range values {
+				if ok, version := pattern.match(value); ok {
+					record(tech, version, pattern.confidence)
+					break
+				}
+			}
+		}
+	}
+
+	for _, tech := range rules.techs {
+		for name, patterns := range tech.headers {
+			if values, ok := signals.headers[http.CanonicalHeaderKey(name)]; ok {
+				try(tech, patterns, strings.Join(values, ", "))
+			}
+		}
+		for name, patterns := range tech.cookies {
+			if value, ok := signals.cookies[name]; ok {
+				try(tech, patterns, value)
+			}
+		}
+		for name, patterns := range tech.meta {
+			if value, ok := signals.meta[name]; ok {
+				try(tech, patterns, value)
+			}
+		}
+		try(tech, tech.html, signals.content)
+		try(tech, tech.scriptSrc, signals.scriptSrc...)
+		try(tech, tech.url, signals.url)
+	}
+
+	// Implied technologies, e.g. WordPress implies PHP, may imply others in
+	// turn. They are no more certain than the technology implying them.
+	for changed := true; changed; {
+		changed = false
+		for name, detected := range found {
+			for _, implied := range rules.index[name].implies {
+				if tech, ok := rules.index[implied.name]; ok && found[implied.name] == nil {
+					confidence := implied.confidence
+					if detected.Confidence < confidence {
+						confidence = detected.Confidence
+					}
+					record(tech, "", confidence)
+					changed = true
+				}
+			}
+		}
+	}
+
+	detected := make([]DetectedTech, 0, len(found))
+	for _, tech := range found {
+		detected = append(detected, *tech)
+	}
+	sort.Slice(detected, func(i, j int) bool { return detected[i].Name < detected[j].Name })
+	return detected
+}
+
+// summarizeTechnologies rolls up the detected technologies across the
+// report, most common first
+func summarizeTechnologies(results []ScanResult) []TechnologyUsage {
+	index := make(map[string]int)
+	var usage []TechnologyUsage
+	for _, result := range results {
+		for _, tech := range result.Technologies {
+			i, ok := index[tech.Name]
+			if !ok {
+				i = len(usage)
+				index[tech.Name] = i
+				usage = append(usage, TechnologyUsage{Name: tech.Name, Category: tech.Category})
+			}
+			usage[i].Count++
+			usage[i].URLs = append(usage[i].URLs, resultKey(result))
+			if tech.Version != "" && !containsString(usage[i].Versions, tech.Version) {
+				usage[i].Versions = append(usage[i].Versions, tech.Version)
+			}
+		}
+	}
+	sort.SliceStable(usage, func(i, j int) bool { return usage[i].Count > usage[j].Count })
+	return usage
+}
+
+// formatTechnologies lists a result's technologies on one line
+func formatTechnologies(techs []DetectedTech) string {
+	var names []string
+	for _, tech := range techs {
+		name := tech.Name
+		if tech.Version != "" {
+			name += " " + tech.Version
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// generateTechnologiesSection renders the technology rollup for the HTML report
+func generateTechnologiesSection(usage []TechnologyUsage) string {
+	if len(usage) == 0 {
+		return ""
+	}
+
+	section := `
+
+            <h2>🧰 Technologies</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>Technology</th>
+                        <th>Category</th>
+                        <th>Versions</th>
+                        <th>Pages</th>
+                    </tr>
+                </thead>
+                <tbody>`
+
+	for _, tech := range usage {
+		section += fmt.Sprintf(`
+                    <tr>
+                        <td><strong>%s</strong></td>
+                        <td>%s</td>
+                        <td>%s</td>
+                        <td>%d</td>
+                    </tr>`,
+			escapeHTML(tech.Name), escapeHTML(tech.Category), escapeHTML(strings.Join(tech.Versions, ", ")), tech.Count)
+	}
+
+	section += `
+                </tbody>
+            </table>`
+	return section
+}
+
+// writeTechnologiesText renders the technology rollup for the TXT report
+func writeTechnologiesText(usage []TechnologyUsage) string {
+	if len(usage) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("🧰 TECHNOLOGIES\n═══════════════════════════════════════════════════════════════════════════\n\n")
+	for _, tech := range usage {
+		line := fmt.Sprintf("    %-24s %3d pages", tech.Name, tech.Count)
+		if len(tech.Versions) > 0 {
+			line += "  (" + strings.Join(tech.Versions, ", ") + ")"
+		}
+		sb.WriteString(line + "\n")
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
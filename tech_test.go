@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testTechRules = `technologies:
+  Nginx:
+    category: Web servers
+    headers:
+      Server: 'nginx(?:/([\d.]+))?\;version:\1'
+  WordPress:
+    category: CMS
+    meta:
+      generator: '^WordPress ?([\d.]+)?\;version:\1'
+    implies: ['PHP', 'MySQL\;confidence:50']
+  Flarum:
+    category: Forum software
+    html: 'flarum-loading\;confidence:40'
+    implies: PHP
+  PHP:
+    category: Programming languages
+  MySQL:
+    category: Databases
+`
+
+func loadTestTechRules(t *testing.T) *TechRules {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "technologies.yaml")
+	if err := os.WriteFile(path, []byte(testTechRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := loadTechRules(path)
+	if err != nil {
+		t.Fatalf("loadTechRules error: %v", err)
+	}
+	return rules
+}
+
+func techByName(techs []DetectedTech) map[string]DetectedTech {
+	byName := make(map[string]DetectedTech)
+	for _, tech := range techs {
+		byName[tech.Name] = tech
+	}
+	return byName
+}
+
+func TestLoadBuiltinTechRules(t *testing.T) {
+	rules, err := loadTechRules("")
+	if err != nil {
+		t.Fatalf("loadTechRules error: %v", err)
+	}
+	if len(rules.techs) == 0 {
+		t.Errorf("built-in rules are empty")
+	}
+}
+
+func TestDetectTechnologies(t *testing.T) {
+	rules := loadTestTechRules(t)
+	result := ScanResult{
+		URL:         "abc.onion",
+		Status:      "SUCCESS",
+		Headers:     http.Header{"Server": {"nginx/1.24.0"}},
+		ContentType: "text/html",
+		Content:     `<html><head><meta name="generator" content="WordPress 6.4.2"></head></html>`,
+	}
+	found := techByName(detectTechnologies(rules, result))
+
+	tests := []struct {
+		name       string
+		version    string
+		confidence int
+	}{
+		{"Nginx", "1.24.0", 100},
+		{"WordPress", "6.4.2", 100},
+		{"PHP", "", 100},
+		{"MySQL", "", 50},
+	}
+	for _, tt := range tests {
+		tech, ok := found[tt.name]
+		if !ok {
+			t.Errorf("%s not detected", tt.name)
+			continue
+		}
+		if tech.Version != tt.version || tech.Confidence != tt.confidence {
+			t.Errorf("%s = %+v, want version %q at %d", tt.name, tech, tt.version, tt.confidence)
+		}
+	}
+	if _, ok := found["Flarum"]; ok {
+		t.Errorf("Flarum detected without its marker")
+	}
+}
+
+func TestDetectTechnologiesImpliedConfidence(t *testing.T) {
+	rules := loadTestTechRules(t)
+	result := ScanResult{
+		URL:         "http://abc.onion/",
+		Status:      "SUCCESS",
+		ContentType: "text/html",
+		Content:     `<html><body><div id="flarum-loading"></div></body></html>`,
+	}
+	found := techByName(detectTechnologies(rules, result))
+	if found["Flarum"].Confidence != 40 {
+		t.Errorf("Flarum confidence = %d, want 40", found["Flarum"].Confidence)
+	}
+	// PHP is implied at 100 but no more certain than Flarum itself
+	if found["PHP"].Confidence != 40 {
+		t.Errorf("PHP confidence = %d, want 40", found["PHP"].Confidence)
+	}
+}
+
+func TestSummarizeTechnologies(t *testing.T) {
+	results := []ScanResult{
+		{URL: "abc.onion", CanonicalURL: "http://abc.onion/", Technologies: []DetectedTech{{Name: "Nginx", Version: "1.24.0"}, {Name: "PHP"}}},
+		{URL: "http://def.onion/", Technologies: []DetectedTech{{Name: "Nginx", Version: "1.25.3"}}},
+	}
+	usage := summarizeTechnologies(results)
+	if len(usage) != 2 || usage[0].Name != "Nginx" {
+		t.Fatalf("usage = %+v, want Nginx first", usage)
+	}
+	nginx := usage[0]
+	if nginx.Count != 2 || len(nginx.Versions) != 2 {
+		t.Errorf("Nginx usage = %+v, want 2 pages with 2 versions", nginx)
+	}
+	if nginx.URLs[0] != "http://abc.onion/" {
+		t.Errorf("Nginx URLs = %v, want the canonical URL first", nginx.URLs)
+	}
+}
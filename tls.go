@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TLS verification modes
+const (
+	// TLSVerify checks certificates against the system roots
+	TLSVerify = "verify"
+	// TLSSkipVerifyOnion accepts any certificate from .onion hosts, whose
+	// address already authenticates the service, and verifies the rest
+	TLSSkipVerifyOnion = "skip-verify-onion"
+)
+
+// TLSPolicy decides which server certificates are accepted
+type TLSPolicy struct {
+	Mode string
+	// Pins maps a hostname to the SHA-256 fingerprints accepted for it in
+	// place of normal verification
+	Pins map[string][]string
+}
+
+// TLSCertificate describes the leaf certificate presented by a server
+type TLSCertificate struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SANs         []string  `json:"sans,omitempty"`
+	SerialNumber string    `json:"serial_number"`
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after"`
+	SHA256       string    `json:"sha256"`
+	SelfSigned   bool      `json:"self_signed"`
+	Version      string    `json:"tls_version,omitempty"`
+	// Verified is whether the chain verifies against the system roots for
+	// the hostname, whatever the policy accepted
+	Verified bool `json:"verified"`
+}
+
+// SharedCertificate is a certificate presented by more than one target
+type SharedCertificate struct {
+	SHA256  string   `json:"sha256"`
+	Subject string   `json:"subject"`
+	URLs    []string `json:"urls"`
+	Targets []string `json:"targets"`
+}
+
+// tlsCertError is a rejected certificate, kept so the failed result can
+// still record it
+type tlsCertError struct {
+	cert TLSCertificate
+	err  error
+}
+
+func (e *tlsCertError) Error() string { return e.err.Error() }
+func (e *tlsCertError) Unwrap() error { return e.err }
+
+// normalizeFingerprint lowercases a SHA-256 fingerprint and drops colons
+// and spaces, so fingerprints copied from openssl or a browser both work
+func normalizeFingerprint(fingerprint string) (string, error) {
+	normalized := strings.ToLower(strings.NewReplacer(":", "", " ", "").Replace(fingerprint))
+	if len(normalized) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", fingerprint)
+	}
+	if _, err := hex.DecodeString(normalized); err != nil {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", fingerprint)
+	}
+	return normalized, nil
+}
+
+// newTLSPolicy builds the TLS policy from the config mode and the targets'
+// pinned fingerprints
+func newTLSPolicy(config *YAMLConfig) (TLSPolicy, error) {
+	policy := TLSPolicy{Mode: config.TLSVerify, Pins: make(map[string][]string)}
+	if policy.Mode == "" {
+		policy.Mode = TLSVerify
+	}
+	if policy.Mode != TLSVerify && policy.Mode != TLSSkipVerifyOnion {
+		return policy, fmt.Errorf("unknown TLS verification mode %q", config.TLSVerify)
+	}
+
+	for _, target := range config.Targets {
+		if len(target.TLSPins) == 0 {
+			continue
+		}
+		u, err := url.Parse(target.CanonicalURL)
+		if err != nil || u.Hostname() == "" {
+			return policy, fmt.Errorf("cannot pin certificates for %s: no hostname", target.URL)
+		}
+		host := strings.ToLower(u.Hostname())
+		for _, pin := range target.TLSPins {
+			fingerprint, err := normalizeFingerprint(pin)
+			if err != nil {
+				return policy, fmt.Errorf("target %s: %w", target.URL, err)
+			}
+			if !containsString(policy.Pins[host], fingerprint) {
+				policy.Pins[host] = append(policy.Pins[host], fingerprint)
+			}
+		}
+	}
+	return policy, nil
+}
+
+// certificateFingerprint returns the hex SHA-256 of a certificate's DER encoding
+func certificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// serverHost returns the lowercased hostname a TLS connection was made to
+func serverHost(state tls.ConnectionState) string {
+	return strings.ToLower(strings.TrimSuffix(state.ServerName, "."))
+}
+
+// verifyChain verifies the server's chain against the system roots
+func verifyChain(state tls.ConnectionState) error {
+	opts := x509.VerifyOptions{DNSName: serverHost(state), Intermediates: x509.NewCertPool()}
+	for _, cert := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// verify checks the server's certificates against the policy
+func (p TLSPolicy) verify(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return fmt.Errorf("server sent no certificate")
+	}
+	host := serverHost(state)
+
+	if pins, ok := p.Pins[host]; ok {
+		fingerprint := certificateFingerprint(state.PeerCertificates[0])
+		if !containsString(pins, fingerprint) {
+			return fmt.Errorf("certificate %s for %s does not match a pinned fingerprint", fingerprint, host)
+		}
+		return nil
+	}
+	if p.Mode == TLSSkipVerifyOnion && strings.HasSuffix(host, ".onion") {
+		return nil
+	}
+	return verifyChain(state)
+}
+
+// tlsConfig returns the client TLS configuration enforcing the policy.
+// Go's own verification is replaced by VerifyConnection so pinned and
+// onion certificates can be accepted per host.
+func (p TLSPolicy) tlsConfig() *tls.Config {
+	return &tls.Config{
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if err := p.verify(state); err != nil {
+				return &tlsCertError{cert: describeCertificate(state), err: err}
+			}
+			return nil
+		},
+	}
+}
+
+// isSelfSigned reports whether a certificate is its own issuer and signed by
+// its own key. CheckSignatureFrom is not used since it rejects certificates
+// that are not CAs, as most self-signed onion certificates are not.
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// describeCertificate records the leaf certificate of a TLS connection
+func describeCertificate(state tls.ConnectionState) TLSCertificate {
+	if len(state.PeerCertificates) == 0 {
+		return TLSCertificate{}
+	}
+	leaf := state.PeerCertificates[0]
+	cert := TLSCertificate{
+		Subject:      leaf.Subject.String(),
+		Issuer:       leaf.Issuer.String(),
+		SerialNumber: leaf.SerialNumber.Text(16),
+		NotBefore:    leaf.NotBefore.UTC(),
+		NotAfter:     leaf.NotAfter.UTC(),
+		SHA256:       certificateFingerprint(leaf),
+		SelfSigned:   isSelfSigned(leaf),
+		Version:      tls.VersionName(state.Version),
+		Verified:     verifyChain(state) == nil,
+	}
+	cert.SANs = append(cert.SANs, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		cert.SANs = append(cert.SANs, ip.String())
+	}
+	for _, uri := range leaf.URIs {
+		cert.SANs = append(cert.SANs, uri.String())
+	}
+	cert.SANs = append(cert.SANs, leaf.EmailAddresses...)
+	return cert
+}
+
+// tlsStateKey is the request context key of the TLS state recorder
+type tlsStateKey struct{}
+
+// withTLSState attaches a recorder for the state of the request's TLS
+// connection. The client completes TLS handshakes itself, so the response
+// does not carry the state.
+func withTLSState(req *http.Request) (*http.Request, *tls.ConnectionState) {
+	state := &tls.ConnectionState{}
+	return req.WithContext(context.WithValue(req.Context(), tlsStateKey{}, state)), state
+}
+
+// recordTLSState stores a completed handshake in the request's recorder, if any
+func recordTLSState(ctx context.Context, state tls.ConnectionState) {
+	if recorder, ok := ctx.Value(tlsStateKey{}).(*tls.ConnectionState); ok {
+		*recorder = state
+	}
+}
+
+// captureCertificate records the certificate of an accepted connection
+func captureCertificate(state *tls.ConnectionState) *TLSCertificate {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := describeCertificate(*state)
+	return &cert
+}
+
+// groupSharedCertificates returns the certificates presented by more than
+// one target
+func groupSharedCertificates(results []ScanResult) []SharedCertificate {
+	groups := make(map[string]*SharedCertificate)
+	var order []string
+	for _, result := range results {
+		if result.TLSCert == nil {
+			continue
+		}
+		target := result.SeedURL
+		if target == "" {
+			target = resultKey(result)
+		}
+		group, ok := groups[result.TLSCert.SHA256]
+		if !ok {
+			group = &SharedCertificate{SHA256: result.TLSCert.SHA256, Subject: result.TLSCert.Subject}
+			groups[result.TLSCert.SHA256] = group
+			order = append(order, result.TLSCert.SHA256)
+		}
+		if page := resultKey(result); !containsString(group.URLs, page) {
+			group.URLs = append(group.URLs, page)
+		}
+		if !containsString(group.Targets, target) {
+			group.Targets = append(group.Targets, target)
+		}
+	}
+
+	var shared []SharedCertificate
+	for _, fingerprint := range order {
+		if len(groups[fingerprint].Targets) > 1 {
+			shared = append(shared, *groups[fingerprint])
+		}
+	}
+	return shared
+}
+
+// formatCertificate summarizes a certificate on one line
+func formatCertificate(cert *TLSCertificate) string {
+	trust := "unverified"
+	if cert.Verified {
+		trust = "verified"
+	}
+	return fmt.Sprintf("%s, issuer %s, valid %s to %s, %s, sha256 %s",
+		cert.Subject, cert.Issuer, cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"),
+		trust, cert.SHA256)
+}
+
+// generateCertificatesSection renders the certificates shared between
+// targets for the HTML report
+func generateCertificatesSection(shared []SharedCertificate) string {
+	if len(shared) == 0 {
+		return ""
+	}
+
+	section := `
+
+            <h2>🔐 Shared Certificates</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>Subject</th>
+                        <th>SHA-256</th>
+                        <th>Targets</th>
+                    </tr>
+                </thead>
+                <tbody>`
+
+	for _, cert := range shared {
+		var targets []string
+		for _, target := range cert.Targets {
+			targets = append(targets, escapeHTML(target))
+		}
+		section += fmt.Sprintf(`
+                    <tr>
+                        <td>%s</td>
+                        <td><small>%s</small></td>
+                        <td>%s</td>
+                    </tr>`,
+			escapeHTML(cert.Subject), cert.SHA256, strings.Join(targets, "<br>"))
+	}
+
+	section += `
+                </tbody>
+            </table>`
+	return section
+}
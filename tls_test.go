@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate creates a certificate for subject signed by parent's key,
+// or self-signed when parent is nil
+func testCertificate(t *testing.T, subject string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: subject},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		DNSNames:              []string{subject},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestIsSelfSigned(t *testing.T) {
+	leaf, _ := testCertificate(t, "abc.onion", false, nil, nil)
+	ca, caKey := testCertificate(t, "Test CA", true, nil, nil)
+	issued, _ := testCertificate(t, "def.onion", false, ca, caKey)
+	// Same name as the CA, but signed by the CA's key rather than its own
+	impostor, _ := testCertificate(t, "Test CA", false, ca, caKey)
+
+	tests := []struct {
+		name string
+		cert *x509.Certificate
+		want bool
+	}{
+		{"self-signed leaf", leaf, true},
+		{"self-signed CA", ca, true},
+		{"CA-issued leaf", issued, false},
+		{"issuer equals subject, other key", impostor, false},
+	}
+	for _, tt := range tests {
+		if got := isSelfSigned(tt.cert); got != tt.want {
+			t.Errorf("%s: isSelfSigned = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDescribeCertificate(t *testing.T) {
+	leaf, _ := testCertificate(t, "abc.onion", false, nil, nil)
+	cert := describeCertificate(tls.ConnectionState{ServerName: "abc.onion", PeerCertificates: []*x509.Certificate{leaf}})
+	if !cert.SelfSigned || cert.Verified {
+		t.Errorf("certificate = %+v, want self-signed and unverified", cert)
+	}
+	if cert.Subject != "CN=abc.onion" || len(cert.SANs) != 1 || cert.SHA256 != certificateFingerprint(leaf) {
+		t.Errorf("certificate = %+v, want the leaf's subject, SANs and fingerprint", cert)
+	}
+}
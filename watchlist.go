@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// snippetContext is the number of bytes shown on each side of a match
+	snippetContext = 60
+	// maxMatchesPerRule bounds the hits recorded per rule and page field
+	maxMatchesPerRule = 20
+)
+
+// severityRanks orders the watchlist severities
+var severityRanks = map[string]int{
+	"info":     0,
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// WatchlistRule is a literal keyword (case-insensitive) or a regex to look
+// for in fetched pages
+type WatchlistRule struct {
+	Label    string `yaml:"label"`
+	Keyword  string `yaml:"keyword,omitempty"`
+	Regex    string `yaml:"regex,omitempty"`
+	Severity string `yaml:"severity,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Watchlist is the set of rules loaded from a watchlist file
+type Watchlist struct {
+	Rules []WatchlistRule `yaml:"rules"`
+}
+
+// WatchlistMatch is a single watchlist hit on a page
+type WatchlistMatch struct {
+	Label    string `json:"label"`
+	Severity string `json:"severity"`
+	Match    string `json:"match"`
+	Field    string `json:"field"`
+	Offset   int    `json:"offset"`
+	Snippet  string `json:"snippet"`
+}
+
+// loadWatchlist reads and compiles a watchlist file
+func loadWatchlist(path string) (*Watchlist, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watchlist: %w", err)
+	}
+
+	var watchlist Watchlist
+	if err := yaml.Unmarshal(data, &watchlist); err != nil {
+		return nil, fmt.Errorf("failed to parse watchlist %s: %w", path, err)
+	}
+
+	for i := range watchlist.Rules {
+		rule := &watchlist.Rules[i]
+		if rule.Severity == "" {
+			rule.Severity = "medium"
+		}
+		rule.Severity = strings.ToLower(rule.Severity)
+		if _, ok := severityRanks[rule.Severity]; !ok {
+			return nil, fmt.Errorf("watchlist rule %d: unknown severity %q", i+1, rule.Severity)
+		}
+
+		switch {
+		case rule.Keyword != "" && rule.Regex != "":
+			return nil, fmt.Errorf("watchlist rule %d: set either keyword or regex, not both", i+1)
+		case rule.Keyword != "":
+			rule.pattern = regexp.MustCompile("(?i)" + regexp.QuoteMeta(rule.Keyword))
+		case rule.Regex != "":
+			rule.pattern, err = regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("watchlist rule %d: %w", i+1, err)
+			}
+		default:
+			return nil, fmt.Errorf("watchlist rule %d: missing keyword or regex", i+1)
+		}
+
+		if rule.Label == "" {
+			rule.Label = rule.Keyword + rule.Regex
+		}
+	}
+
+	return &watchlist, nil
+}
+
+// matchWatchlist runs every rule over a result's extracted text and raw
+// content, recording every occurrence in each field. A content hit inside
+// visible text that the text field already matched is left out, so text
+// shown on the page is not reported twice.
+func matchWatchlist(watchlist *Watchlist, result *ScanResult) {
+	if watchlist == nil || !hasContent(*result) {
+		return
+	}
+
+	var visible [][2]int
+	if result.Text != "" {
+		visible = visibleTextRanges(result.Content)
+	}
+	for _, rule := range watchlist.Rules {
+		inText := make(map[string]bool)
+		for _, loc := range rule.pattern.FindAllStringIndex(result.Text, maxMatchesPerRule) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			inText[result.Text[loc[0]:loc[1]]] = true
+			result.Matches = append(result.Matches, newWatchlistMatch(rule, "text", result.Text, loc))
+		}
+		for _, loc := range rule.pattern.FindAllStringIndex(result.Content, maxMatchesPerRule) {
+			if loc[0] == loc[1] || (inText[result.Content[loc[0]:loc[1]]] && withinRanges(visible, loc)) {
+				continue
+			}
+			result.Matches = append(result.Matches, newWatchlistMatch(rule, "content", result.Content, loc))
+		}
+	}
+}
+
+// newWatchlistMatch records a rule's hit at loc in a page field
+func newWatchlistMatch(rule WatchlistRule, field, text string, loc []int) WatchlistMatch {
+	return WatchlistMatch{
+		Label:    rule.Label,
+		Severity: rule.Severity,
+		Match:    text[loc[0]:loc[1]],
+		Field:    field,
+		Offset:   loc[0],
+		Snippet:  matchSnippet(text, loc[0], loc[1]),
+	}
+}
+
+// visibleTextRanges returns the byte ranges of an HTML document's text nodes
+// that extractText keeps, i.e. those outside script, style and similar
+// elements
+func visibleTextRanges(content string) [][2]int {
+	var ranges [][2]int
+	z := html.NewTokenizer(strings.NewReader(content))
+	offset, skipped := 0, 0
+	for {
+		tokenType := z.Next()
+		if tokenType == html.ErrorToken {
+			return ranges
+		}
+		size := len(z.Raw())
+		switch tokenType {
+		case html.TextToken:
+			if skipped == 0 {
+				ranges = append(ranges, [2]int{offset, offset + size})
+			}
+		case html.StartTagToken:
+			if name, _ := z.TagName(); skippedTextElements[string(name)] {
+				skipped++
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); skippedTextElements[string(name)] && skipped > 0 {
+				skipped--
+			}
+		}
+		offset += size
+	}
+}
+
+// withinRanges reports whether loc lies inside one of the ranges
+func withinRanges(ranges [][2]int, loc []int) bool {
+	for _, r := range ranges {
+		if loc[0] >= r[0] && loc[1] <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSnippet returns the match with some surrounding text, whitespace collapsed
+func matchSnippet(text string, start, end int) string {
+	from := start - snippetContext
+	if from < 0 {
+		from = 0
+	}
+	to := end + snippetContext
+	if to > len(text) {
+		to = len(text)
+	}
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+	return strings.Join(strings.Fields(text[from:to]), " ")
+}
+
+// severityAtLeast reports whether severity is at or above the threshold
+func severityAtLeast(severity, threshold string) bool {
+	return severityRanks[strings.ToLower(severity)] >= severityRanks[strings.ToLower(threshold)]
+}
+
+// countMatchesAtLeast returns the number of matches in the report at or
+// above the threshold
+func countMatchesAtLeast(report ScanReport, threshold string) int {
+	count := 0
+	for _, result := range report.Results {
+		for _, match := range result.Matches {
+			if severityAtLeast(match.Severity, threshold) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// generateMatchesSection renders the watchlist hits for the HTML report
+func generateMatchesSection(report ScanReport) string {
+	section := ""
+	for _, result := range report.Results {
+		for _, match := range result.Matches {
+			section += fmt.Sprintf(`
+                    <tr>
+                        <td><strong>%s</strong></td>
+                        <td class="%s">%s</td>
+                        <td>%s</td>
+                        <td>%s</td>
+                        <td>%s @ %d</td>
+                    </tr>`,
+				escapeHTML(result.URL), severityClass(match.Severity), strings.ToUpper(match.Severity),
+				escapeHTML(match.Label), escapeHTML(match.Snippet), match.Field, match.Offset)
+		}
+	}
+	if section == "" {
+		return ""
+	}
+
+	return `
+
+            <h2>🚨 Matches</h2>
+            <table class="results-table">
+                <thead>
+                    <tr>
+                        <th>URL</th>
+                        <th>Severity</th>
+                        <th>Label</th>
+                        <th>Snippet</th>
+                        <th>Location</th>
+                    </tr>
+                </thead>
+                <tbody>` + section + `
+                </tbody>
+            </table>`
+}
+
+// severityClass maps a severity to a report status color
+func severityClass(severity string) string {
+	switch {
+	case severityAtLeast(severity, "high"):
+		return "status-failed"
+	case severityAtLeast(severity, "medium"):
+		return "status-error"
+	default:
+		return "status-success"
+	}
+}
+
+// writeMatchesText renders the watchlist hits for the TXT report
+func writeMatchesText(report ScanReport) string {
+	var sb strings.Builder
+	for _, result := range report.Results {
+		for _, match := range result.Matches {
+			sb.WriteString(fmt.Sprintf("[%s] %s\n    Label:   %s\n    Match:   %s (%s @ %d)\n    Snippet: %s\n\n",
+				strings.ToUpper(match.Severity), result.URL, match.Label, match.Match, match.Field, match.Offset, match.Snippet))
+		}
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "🚨 MATCHES\n═══════════════════════════════════════════════════════════════════════════\n\n" + sb.String()
+}
+
+// writeMatchesCSV saves the watchlist hits as a CSV file
+func writeMatchesCSV(report ScanReport, path string) error {
+	var sb strings.Builder
+	sb.WriteString("URL,Severity,Label,Match,Field,Offset,Snippet\n")
+	count := 0
+	for _, result := range report.Results {
+		for _, match := range result.Matches {
+			sb.WriteString(fmt.Sprintf("%s,%s,%s,%s,%s,%d,%s\n",
+				result.URL, match.Severity, csvQuote(match.Label), csvQuote(match.Match),
+				match.Field, match.Offset, csvQuote(match.Snippet)))
+			count++
+		}
+	}
+	if count == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale matches CSV: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write matches CSV: %w", err)
+	}
+	return nil
+}
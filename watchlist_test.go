@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestMatchWatchlist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchlist.yaml")
+	data := `rules:
+  - keyword: acme corp
+    severity: high
+  - label: btc
+    regex: 'bc1[a-z0-9]{8}'
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	watchlist, err := loadWatchlist(path)
+	if err != nil {
+		t.Fatalf("loadWatchlist error: %v", err)
+	}
+
+	result := ScanResult{
+		Status:  "SUCCESS",
+		Content: `<html><body><p>Leaked: ACME Corp</p><!-- pay bc1qqqqqqqqq --></body></html>`,
+		Text:    "Leaked: ACME Corp",
+	}
+	matchWatchlist(watchlist, &result)
+
+	if len(result.Matches) != 2 {
+		t.Fatalf("got %d matches, want 2: %+v", len(result.Matches), result.Matches)
+	}
+	visible := result.Matches[0]
+	if visible.Label != "acme corp" || visible.Field != "text" || visible.Severity != "high" {
+		t.Errorf("visible match = %+v, want acme corp in text at high", visible)
+	}
+	hidden := result.Matches[1]
+	if hidden.Label != "btc" || hidden.Field != "content" || hidden.Match != "bc1qqqqqqqq" {
+		t.Errorf("hidden match = %+v, want btc address in content", hidden)
+	}
+	if got := countMatchesAtLeast(ScanReport{Results: []ScanResult{result}}, "high"); got != 1 {
+		t.Errorf("countMatchesAtLeast(high) = %d, want 1", got)
+	}
+}
+
+func TestMatchWatchlistPlainText(t *testing.T) {
+	watchlist := &Watchlist{Rules: []WatchlistRule{{Label: "leak", Severity: "low", pattern: regexp.MustCompile("leak")}}}
+	result := ScanResult{Status: "SUCCESS", Content: "leak one\nleak two"}
+	matchWatchlist(watchlist, &result)
+	if len(result.Matches) != 2 || result.Matches[0].Offset != 0 || result.Matches[1].Offset != 9 {
+		t.Errorf("matches = %+v, want both content matches", result.Matches)
+	}
+}
+
+func TestMatchWatchlistEveryOccurrence(t *testing.T) {
+	watchlist := &Watchlist{Rules: []WatchlistRule{{Label: "ceo", Severity: "high", pattern: regexp.MustCompile("(?i)jane doe")}}}
+	content := `<html><head><title>Jane Doe</title><script>var target = "Jane Doe";</script></head>
+<body><p>Jane Doe was seen.</p><img alt="Jane Doe"><p>Later, jane doe again.</p></body></html>`
+	result := ScanResult{Status: "SUCCESS", ContentType: "text/html", Content: content}
+	extractPageInfo(&result)
+	matchWatchlist(watchlist, &result)
+
+	var text, markup []string
+	for _, match := range result.Matches {
+		if match.Field == "text" {
+			text = append(text, match.Match)
+		} else {
+			markup = append(markup, result.Content[match.Offset-8:match.Offset])
+		}
+	}
+	// Title and both paragraphs are visible text
+	if len(text) != 3 {
+		t.Errorf("text matches = %q, want all three visible mentions", text)
+	}
+	// Only the script and the alt attribute are not in the text
+	if len(markup) != 2 || markup[0] != `rget = "` || markup[1] != `mg alt="` {
+		t.Errorf("content matches preceded by %q, want the script and the alt attribute", markup)
+	}
+}
+
+func TestVisibleTextRanges(t *testing.T) {
+	content := `<p>one</p><script>two</script><style>x</style>three`
+	ranges := visibleTextRanges(content)
+	var got []string
+	for _, r := range ranges {
+		got = append(got, content[r[0]:r[1]])
+	}
+	if len(got) != 2 || got[0] != "one" || got[1] != "three" {
+		t.Errorf("visible text = %q, want one and three", got)
+	}
+}